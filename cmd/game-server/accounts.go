@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/server"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+	uuid "github.com/satori/go.uuid"
+	cli "github.com/urfave/cli"
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// accountRoutes adds /register, /login & /logout. Registering links the guest making the request to the
+// new account, logging in swaps the userid cookie for the account's user & logging out hands out a
+// fresh guest one. Failed logins count against lt.
+func accountRoutes(mux *http.ServeMux, s gsinterfaces.Server, a *accounts.Accounts, lt *loginThrottle) {
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := readCredentials(w, r)
+		if !ok {
+			return
+		}
+		guestID, _ := userCookie(r)
+		acct, err := a.Register(c.Username, c.Password, guestID)
+		switch err {
+		case nil:
+		case accounts.ErrInvalidUsername, accounts.ErrInvalidPassword:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case accounts.ErrUsernameTaken:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			log.Error(err)
+			http.Error(w, "unable to register right now", http.StatusInternalServerError)
+			return
+		}
+		if err := s.GetUser(acct.UserID, acct.Username).SetName(acct.Username); err != nil {
+			log.Error(err)
+		}
+		loggedIn(w, acct)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := readCredentials(w, r)
+		if !ok {
+			return
+		}
+		addr := clientAddress(r)
+		if !lt.allow(w, addr) {
+			return
+		}
+		acct, err := a.Login(c.Username, c.Password)
+		switch err {
+		case nil:
+		case accounts.ErrInvalidCredentials:
+			lt.failed(addr, time.Now())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		default:
+			log.Error(err)
+			http.Error(w, "unable to log in right now", http.StatusInternalServerError)
+			return
+		}
+		log.Infof("'%s' logged in as '%s'", acct.UserID, acct.Username)
+		loggedIn(w, acct)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		u := uuid.Must(uuid.NewV4()).String()
+		if err := setUserCookie(w, u); err != nil {
+			log.Error(err)
+			http.Error(w, "unable to log out right now", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"user_id": u})
+	})
+}
+
+func readCredentials(w http.ResponseWriter, r *http.Request) (*credentials, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	c := &credentials{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(c); err != nil {
+		http.Error(w, "expected a JSON object with a username & password", http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
+
+func loggedIn(w http.ResponseWriter, acct *storage.Account) {
+	if err := setUserCookie(w, acct.UserID); err != nil {
+		log.Error(err)
+		http.Error(w, "unable to log in right now", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"user_id":  acct.UserID,
+		"username": acct.Username,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+// roleEntry sets the role of a registered user straight in the data dir, it's how the first admin is made
+func roleEntry(c *cli.Context) error {
+	dir := c.String("data-dir")
+	if dir == "" {
+		return errors.New("--data-dir is required")
+	}
+	if c.NArg() != 2 {
+		return errors.New("expected a username and a role")
+	}
+	username, role := accounts.Normalize(c.Args().Get(0)), c.Args().Get(1)
+	if !server.ValidRole(role) {
+		return fmt.Errorf("unknown role '%s'", role)
+	}
+	store, err := storage.NewFile(dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	acct, err := store.LoadAccount(username)
+	if err != nil {
+		return fmt.Errorf("unable to find account '%s': %s", username, err)
+	}
+	p, err := store.LoadUser(acct.UserID)
+	if err != nil {
+		return fmt.Errorf("unable to load user '%s': %s", acct.UserID, err)
+	}
+	p.Role = role
+	if role == server.RolePlayer {
+		p.Role = ""
+	}
+	if err := store.SaveUser(p); err != nil {
+		return err
+	}
+	fmt.Printf("'%s' is now a %s\n", username, role)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/server"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	"github.com/gorilla/websocket"
+)
+
+// useCookieKeys signs & reads cookies with kf for the rest of the test
+func useCookieKeys(t *testing.T, kf *keyFile) {
+	t.Helper()
+	cs, err := cookieCodecs(kf.pairs(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, oldMaxAge := codecs, cookieMaxAge
+	codecs, cookieMaxAge = cs, time.Hour
+	t.Cleanup(func() { codecs, cookieMaxAge = old, oldMaxAge })
+}
+
+// handOut runs the cookie handler for a request carrying cookie, if any
+func handOut(cookie *http.Cookie) (string, bool, *http.Cookie) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	u, ok := userCookieHandler(w, r)
+	cs := w.Result().Cookies()
+	if len(cs) != 1 {
+		return u, ok, nil
+	}
+	return u, ok, cs[0]
+}
+
+func TestCookieMaxAgeRequired(t *testing.T) {
+	kf := &keyFile{Keys: []keyPair{newKeyPair()}}
+	for _, d := range []time.Duration{0, -time.Hour, 500 * time.Millisecond} {
+		if _, err := cookieCodecs(kf.pairs(), d); err == nil {
+			t.Errorf("accepted a max age of %s", d)
+		}
+	}
+}
+
+func TestUserCookie(t *testing.T) {
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	u, ok, c := handOut(nil)
+	if ok || u == "" || c == nil {
+		t.Fatalf("got %q %v %v", u, ok, c)
+	}
+	if c.MaxAge != 3600 || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("got %+v", c)
+	}
+	again, ok, renewed := handOut(c)
+	if !ok || again != u || renewed == nil {
+		t.Fatalf("got %q %v, want %q", again, ok, u)
+	}
+}
+
+func TestUserCookieTampered(t *testing.T) {
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	u, _, c := handOut(nil)
+	b := []byte(c.Value)
+	b[len(b)/2] ^= 1
+	c.Value = string(b)
+	got, ok, _ := handOut(c)
+	if ok || got == u {
+		t.Fatal("accepted a tampered cookie")
+	}
+
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	if _, ok, _ := handOut(c); ok {
+		t.Fatal("accepted a cookie signed with an unknown key")
+	}
+}
+
+func TestUserCookieRotation(t *testing.T) {
+	previous := newKeyPair()
+	useCookieKeys(t, &keyFile{Keys: []keyPair{previous}})
+	u, _, c := handOut(nil)
+
+	current := newKeyPair()
+	useCookieKeys(t, &keyFile{Keys: []keyPair{current, previous}})
+	got, ok, renewed := handOut(c)
+	if !ok || got != u {
+		t.Fatal("a cookie signed with the previous key stopped working")
+	}
+
+	// It's handed out again signed with the current key, so it outlives the previous one
+	useCookieKeys(t, &keyFile{Keys: []keyPair{current}})
+	if got, ok, _ := handOut(renewed); !ok || got != u {
+		t.Fatal("the renewed cookie wasn't signed with the current key")
+	}
+	if _, ok, _ := handOut(c); ok {
+		t.Fatal("accepted a cookie signed with a key that was dropped")
+	}
+}
+
+func TestWebsocketRenewsCookie(t *testing.T) {
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	u, _, c := handOut(nil)
+	store := storage.NewMemory()
+	cfg := server.DefaultConfig()
+	cfg.Store = store
+	s := server.New(cfg)
+	defer s.Shutdown(0)
+	ts := httptest.NewServer(httpRouteHandler(s, accounts.New(store), newTestTokens(time.Hour), "", 0).Handler)
+	defer ts.Close()
+
+	h := http.Header{}
+	h.Set("Cookie", c.String())
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cs := resp.Cookies()
+	if len(cs) != 1 || cs[0].Name != "userid" {
+		t.Fatalf("got cookies %v", cs)
+	}
+	if got, ok, _ := handOut(cs[0]); !ok || got != u {
+		t.Fatalf("renewed cookie is for %q", got)
+	}
+}
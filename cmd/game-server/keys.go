@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	cli "github.com/urfave/cli"
+)
+
+var keyFileFlag = cli.StringFlag{
+	Name:   "key-file",
+	Usage:  "JSON file holding the current & previous cookie keys, see the keys command",
+	EnvVar: "KEY_FILE",
+}
+
+// keyPair is one hash & block key for cookies, the block key may be empty to only sign them
+type keyPair struct {
+	Hash    []byte    `json:"hash"`
+	Block   []byte    `json:"block,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// keyFile holds the current cookie keys first followed by the previous ones, which are only used to
+// read cookies handed out before the last rotation.
+type keyFile struct {
+	Keys []keyPair `json:"keys"`
+}
+
+func newKeyPair() keyPair {
+	return keyPair{
+		Hash:    securecookie.GenerateRandomKey(64),
+		Block:   securecookie.GenerateRandomKey(32),
+		Created: time.Now(),
+	}
+}
+
+func loadKeys(path string) (*keyFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kf := &keyFile{}
+	if err := json.Unmarshal(b, kf); err != nil {
+		return nil, fmt.Errorf("unable to read key file '%s': %s", path, err)
+	}
+	if len(kf.Keys) == 0 {
+		return nil, fmt.Errorf("key file '%s' has no keys", path)
+	}
+	for i, k := range kf.Keys {
+		if len(k.Hash) == 0 {
+			return nil, fmt.Errorf("key %d in '%s' has no hash key", i, path)
+		}
+		switch len(k.Block) {
+		case 0, 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("key %d in '%s' has a block key of %d bytes, it has to be 16, 24 or 32", i, path, len(k.Block))
+		}
+	}
+	return kf, nil
+}
+
+// save writes the key file readable by its owner only, replacing it in one go
+func (kf *keyFile) save(path string) error {
+	b, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pairs flattens the keys the way securecookie.CodecsFromPairs wants them
+func (kf *keyFile) pairs() [][]byte {
+	ps := make([][]byte, 0, 2*len(kf.Keys))
+	for _, k := range kf.Keys {
+		block := k.Block
+		if len(block) == 0 {
+			block = nil
+		}
+		ps = append(ps, k.Hash, block)
+	}
+	return ps
+}
+
+func keysGenerateEntry(c *cli.Context) error {
+	path := c.String("key-file")
+	if path == "" {
+		return errors.New("--key-file is required")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("'%s' already exists, use rotate to replace its keys", path)
+	}
+	kf := &keyFile{Keys: []keyPair{newKeyPair()}}
+	if err := kf.save(path); err != nil {
+		return err
+	}
+	fmt.Printf("generated cookie keys in '%s'\n", path)
+	return nil
+}
+
+func keysRotateEntry(c *cli.Context) error {
+	path := c.String("key-file")
+	if path == "" {
+		return errors.New("--key-file is required")
+	}
+	kf, err := loadKeys(path)
+	if err != nil {
+		return err
+	}
+	keep := c.Int("keep")
+	if keep < 0 {
+		keep = 0
+	}
+	if len(kf.Keys) > keep {
+		kf.Keys = kf.Keys[:keep]
+	}
+	kf.Keys = append([]keyPair{newKeyPair()}, kf.Keys...)
+	if err := kf.save(path); err != nil {
+		return err
+	}
+	fmt.Printf("rotated cookie keys in '%s', %d previous keys still accepted\n", path, len(kf.Keys)-1)
+	return nil
+}
@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/admin"
+	"github.com/GregoryDosh/game-server/pkg/event"
 	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
 	"github.com/GregoryDosh/game-server/pkg/server"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	ws "github.com/GregoryDosh/game-server/pkg/websocket"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/websocket"
@@ -28,6 +38,7 @@ const (
 var (
 	origin   string
 	upgrader = websocket.Upgrader{
+		Subprotocols: []string{bearerProtocol},
 		CheckOrigin: func(r *http.Request) bool {
 			if origin == "*" {
 				return true
@@ -41,7 +52,11 @@ var (
 )
 
 // Global cookie parameters
-var sc *securecookie.SecureCookie
+var (
+	codecs       []securecookie.Codec
+	cookieMaxAge time.Duration
+	cookieSecure bool
+)
 
 func main() {
 	app := cli.NewApp()
@@ -49,6 +64,51 @@ func main() {
 	app.Usage = "serve up games through a websocket connections"
 	app.Version = "0.1"
 	app.Action = appEntry
+	app.Commands = []cli.Command{
+		{
+			Name:   "schema",
+			Usage:  "print the JSON Schema of every event clients can send",
+			Action: schemaEntry,
+		},
+		{
+			Name:      "role",
+			Usage:     "give a registered user a role: player, moderator or admin",
+			ArgsUsage: "<username> <role>",
+			Action:    roleEntry,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "data-dir",
+					Usage:  "Directory the server keeps its users in",
+					EnvVar: "DATA_DIR",
+				},
+			},
+		},
+		{
+			Name:  "keys",
+			Usage: "manage the key file cookies are signed & encrypted with",
+			Subcommands: []cli.Command{
+				{
+					Name:   "generate",
+					Usage:  "create a new key file",
+					Action: keysGenerateEntry,
+					Flags:  []cli.Flag{keyFileFlag},
+				},
+				{
+					Name:   "rotate",
+					Usage:  "add a new current key, keeping a few previous ones so cookies already handed out stay valid",
+					Action: keysRotateEntry,
+					Flags: []cli.Flag{
+						keyFileFlag,
+						cli.IntFlag{
+							Name:  "keep",
+							Usage: "How many previous keys are still accepted",
+							Value: 2,
+						},
+					},
+				},
+			},
+		},
+	}
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:   "host",
@@ -62,16 +122,30 @@ func main() {
 			Value:  9999,
 			EnvVar: "LISTEN_PORT",
 		},
+		keyFileFlag,
 		cli.StringFlag{
 			Name:   "hash-key",
-			Usage:  "Hash key used for secure cookies",
+			Usage:  "Hash key used for secure cookies when there's no key file",
 			EnvVar: "HASH_KEY",
 		},
 		cli.StringFlag{
 			Name:   "block-key",
-			Usage:  "Block key used for secure cookies",
+			Usage:  "Block key used for secure cookies when there's no key file",
 			EnvVar: "BLOCK_KEY",
 		},
+		cli.DurationFlag{
+			Name:        "cookie-max-age",
+			Usage:       "How long a cookie is good for without the user coming back",
+			Value:       30 * 24 * time.Hour,
+			EnvVar:      "COOKIE_MAX_AGE",
+			Destination: &cookieMaxAge,
+		},
+		cli.BoolFlag{
+			Name:        "cookie-secure",
+			Usage:       "Only send cookies over HTTPS",
+			EnvVar:      "COOKIE_SECURE",
+			Destination: &cookieSecure,
+		},
 		cli.StringFlag{
 			Name:        "origin",
 			Usage:       "Sets the allowable origin",
@@ -79,6 +153,96 @@ func main() {
 			EnvVar:      "ORIGIN",
 			Destination: &origin,
 		},
+		cli.DurationFlag{
+			Name:   "game-idle-timeout",
+			Usage:  "How long a game can go without any connected players before it's closed",
+			Value:  server.DefaultConfig().IdleTimeout,
+			EnvVar: "GAME_IDLE_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "game-finished-grace",
+			Usage:  "How long a finished game is kept around before it's closed",
+			Value:  server.DefaultConfig().FinishedGracePeriod,
+			EnvVar: "GAME_FINISHED_GRACE",
+		},
+		cli.IntFlag{
+			Name:   "queue-size",
+			Usage:  "How many outbound messages can wait per connection",
+			Value:  ws.DefaultQueueConfig().Size,
+			EnvVar: "QUEUE_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "queue-policy",
+			Usage:  "What to do when a connection's queue is full: expire, drop-oldest, coalesce or disconnect",
+			Value:  ws.DefaultQueueConfig().Policy,
+			EnvVar: "QUEUE_POLICY",
+		},
+		cli.DurationFlag{
+			Name:   "queue-expire-after",
+			Usage:  "How long the expire policy lets a message wait for room in a full queue before dropping it",
+			Value:  ws.DefaultQueueConfig().ExpireAfter,
+			EnvVar: "QUEUE_EXPIRE_AFTER",
+		},
+		cli.Float64Flag{
+			Name:   "event-rate",
+			Usage:  "How many events per second a user may send on average, 0 disables rate limiting",
+			Value:  server.DefaultConfig().EventRate,
+			EnvVar: "EVENT_RATE",
+		},
+		cli.IntFlag{
+			Name:   "event-burst",
+			Usage:  "How many events a user may send in a quick burst",
+			Value:  server.DefaultConfig().EventBurst,
+			EnvVar: "EVENT_BURST",
+		},
+		cli.DurationFlag{
+			Name:   "token-ttl",
+			Usage:  "How long a bearer token issued by /token is good for",
+			Value:  24 * time.Hour,
+			EnvVar: "TOKEN_TTL",
+		},
+		cli.StringFlag{
+			Name:   "data-dir",
+			Usage:  "Directory users, games & results are kept in, nothing is kept between restarts when empty",
+			EnvVar: "DATA_DIR",
+		},
+		cli.DurationFlag{
+			Name:   "snapshot-interval",
+			Usage:  "How often running games are saved to the data dir, 0 only saves them on shutdown",
+			Value:  server.DefaultConfig().SnapshotInterval,
+			EnvVar: "SNAPSHOT_INTERVAL",
+		},
+		cli.IntFlag{
+			Name:   "shutdown-timeout",
+			Usage:  "How many `seconds` games get to finish when shutting down before they're snapshotted",
+			Value:  30,
+			EnvVar: "SHUTDOWN_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "admin-addr",
+			Usage:  "`host:port` the admin dashboard & API listen on, disabled when empty",
+			EnvVar: "ADMIN_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "admin-password-file",
+			Usage:  "File holding the admin dashboard & API password, the username is admin. Without one it comes from ADMIN_PASSWORD, never a flag, so it stays out of the process list",
+			EnvVar: "ADMIN_PASSWORD_FILE",
+		},
+		cli.StringFlag{
+			Name:   "admin-tls-cert",
+			Usage:  "Certificate the admin listener serves HTTPS with, without one it may only listen on localhost",
+			EnvVar: "ADMIN_TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   "admin-tls-key",
+			Usage:  "Private key of --admin-tls-cert",
+			EnvVar: "ADMIN_TLS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "metrics-addr",
+			Usage:  "`host:port` Prometheus can scrape /metrics on without the admin password, disabled when empty. The admin listener serves the same /metrics behind its password",
+			EnvVar: "METRICS_ADDR",
+		},
 		cli.StringFlag{
 			Name:   "log-level,l",
 			Usage:  "Log `level` for output",
@@ -101,7 +265,7 @@ func main() {
 
 func appEntry(c *cli.Context) {
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	host := c.String("host")
 	port := c.Int("port")
@@ -133,30 +297,131 @@ func appEntry(c *cli.Context) {
 		defer pprof.StopCPUProfile()
 	}
 
-	if len(hashKey) == 0 {
-		log.Debug("Generating hashKey")
-		hashKey = securecookie.GenerateRandomKey(32)
+	var pairs [][]byte
+	if path := c.String("key-file"); path != "" {
+		kf, err := loadKeys(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pairs = kf.pairs()
+		log.Debugf("loaded %d cookie keys from '%s'", len(kf.Keys), path)
+	} else {
+		if len(hashKey) == 0 {
+			log.Warn("no cookie keys configured, everyone will be logged out when the server restarts")
+			hashKey = securecookie.GenerateRandomKey(32)
+		}
+
+		switch len(blockKey) {
+		case 16, 24, 32:
+		case 0:
+			log.Debug("encryption disabled")
+			blockKey = nil
+		default:
+			log.Debug("Invalid blockKey size using generated blockKey")
+			blockKey = securecookie.GenerateRandomKey(32)
+		}
+		pairs = [][]byte{hashKey, blockKey}
+	}
+	var err error
+	if codecs, err = cookieCodecs(pairs, cookieMaxAge); err != nil {
+		log.Fatal(err)
 	}
 
-	switch len(blockKey) {
-	case 16, 24, 32:
-	case 0:
-		log.Debug("encryption disabled")
-		blockKey = nil
-	default:
-		log.Debug("Invalid blockKey size using generated blockKey")
-		blockKey = securecookie.GenerateRandomKey(32)
+	config := server.DefaultConfig()
+	config.IdleTimeout = c.Duration("game-idle-timeout")
+	config.FinishedGracePeriod = c.Duration("game-finished-grace")
+	config.Queue = ws.QueueConfig{
+		Size:        c.Int("queue-size"),
+		Policy:      c.String("queue-policy"),
+		ExpireAfter: c.Duration("queue-expire-after"),
+	}
+	config.EventRate = c.Float64("event-rate")
+	config.EventBurst = c.Int("event-burst")
+	config.SnapshotInterval = c.Duration("snapshot-interval")
+	if err := config.Queue.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if dir := c.String("data-dir"); dir != "" {
+		store, err := storage.NewFile(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Store = store
+	} else {
+		config.Store = storage.NewMemory()
 	}
+	config.Accounts = accounts.New(config.Store)
+	s := server.New(config)
+	tks := newTokens(pairs, c.Duration("token-ttl"), config.Store)
+	hs := httpRouteHandler(s, config.Accounts, tks, host, port)
+	go func() {
+		if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
-	sc = securecookie.New(hashKey, blockKey)
+	var as *http.Server
+	if addr := c.String("admin-addr"); addr != "" {
+		password, err := adminPassword(c.String("admin-password-file"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		cert, key := c.String("admin-tls-cert"), c.String("admin-tls-key")
+		if (cert == "") != (key == "") {
+			log.Fatal("--admin-tls-cert & --admin-tls-key go together")
+		}
+		if cert == "" && !admin.Loopback(addr) {
+			log.Fatalf("the admin password would be sent in the clear, '%s' has to be on localhost without --admin-tls-cert", addr)
+		}
+		as = &http.Server{Addr: addr, Handler: admin.Handler(s, password)}
+		go func() {
+			var err error
+			if cert != "" {
+				err = as.ListenAndServeTLS(cert, key)
+			} else {
+				err = as.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		log.Infof("admin dashboard listening on %s", addr)
+	}
 
-	s := server.New()
-	go httpRouteHandler(s, host, port)
+	var ms *http.Server
+	if addr := c.String("metrics-addr"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(s.WriteMetrics))
+		ms = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			if err := ms.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		log.Infof("metrics listening on %s", addr)
+	}
 
 	<-stop
 
 	log.Info("shutting down")
-	s.Shutdown(5)
+	// Stop taking new connections first, the websockets already open are hijacked & left to s.Shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := hs.Shutdown(ctx); err != nil {
+		log.Error(err)
+	}
+	cancel()
+	s.Shutdown(c.Int("shutdown-timeout"))
+	// The admin & metrics listeners stay up until the drain is over so it can be watched
+	for _, l := range []*http.Server{as, ms} {
+		if l == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := l.Shutdown(ctx); err != nil {
+			log.Error(err)
+		}
+		cancel()
+	}
 
 	if memprofile != "" {
 		f, err := os.Create(memprofile)
@@ -173,94 +438,152 @@ func appEntry(c *cli.Context) {
 	}
 }
 
+// adminPassword reads the admin password from file, or ADMIN_PASSWORD when there's no file
+func adminPassword(file string) (string, error) {
+	password := os.Getenv("ADMIN_PASSWORD")
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the admin password: %s", err)
+		}
+		password = strings.TrimRight(string(b), "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("--admin-password-file or ADMIN_PASSWORD is required along with --admin-addr")
+	}
+	return password, nil
+}
+
+func schemaEntry(c *cli.Context) error {
+	b, err := event.JSONSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
 func userCookieHandler(w http.ResponseWriter, r *http.Request) (string, bool) {
-	// If the cookie is valid, let em through and return the key-value pairs & true for being okay
-	if cookie, err := r.Cookie("userid"); err == nil {
-		u := ""
-		if err = sc.Decode("userid", cookie.Value, &u); err == nil {
-			return u, true
+	// If the cookie is valid, let em through and return the key-value pairs & true for being okay. It's
+	// handed out again so it only expires once they stop coming back, signed with the current key.
+	if u, ok := userCookie(r); ok {
+		if err := setUserCookie(w, u); err != nil {
+			log.Error(err)
 		}
+		return u, true
 	}
 	// If here, we're assuming cookie doesn't exist or isn't valid, so give them a UUID to use and return it.
 	u := uuid.Must(uuid.NewV4()).String()
-	encoded, err := sc.Encode("userid", u)
-	if err != nil {
+	if err := setUserCookie(w, u); err != nil {
 		log.Error(err)
 		return "", false
 	}
+	return u, false
+}
+
+// cookieCodecs makes the codecs cookies are signed & read with, which refuse cookies older than maxAge.
+// A max age under a second would be 0 to securecookie, which turns off its expiry check altogether.
+func cookieCodecs(pairs [][]byte, maxAge time.Duration) ([]securecookie.Codec, error) {
+	if maxAge < time.Second {
+		return nil, fmt.Errorf("cookie max age has to be at least a second, got %s", maxAge)
+	}
+	cs := securecookie.CodecsFromPairs(pairs...)
+	for _, codec := range cs {
+		codec.(*securecookie.SecureCookie).MaxAge(int(maxAge.Seconds()))
+	}
+	return cs, nil
+}
+
+// userCookie returns the user id the request's userid cookie holds, if it has a valid one
+func userCookie(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("userid")
+	if err != nil {
+		return "", false
+	}
+	u := ""
+	if err = securecookie.DecodeMulti("userid", cookie.Value, &u, codecs...); err != nil {
+		return "", false
+	}
+	return u, true
+}
+
+func setUserCookie(w http.ResponseWriter, u string) error {
+	encoded, err := securecookie.EncodeMulti("userid", u, codecs...)
+	if err != nil {
+		return err
+	}
 	cookie := &http.Cookie{
-		Name:  "userid",
-		Value: encoded,
+		Name:     "userid",
+		Value:    encoded,
+		Path:     "/",
+		MaxAge:   int(cookieMaxAge.Seconds()),
+		Expires:  time.Now().Add(cookieMaxAge),
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, cookie)
-	return u, false
+	return nil
 }
 
-func httpRouteHandler(s gsinterfaces.Server, host string, port int) {
-	// au := &AdminUser{}
-	// g1 := &moose.GameSecretMoose{GameName: "Lunchtime Brawl"}
-	// g2 := &moose.GameSecretMoose{GameName: "HH Checkn"}
-	// for _, p := range []*hi.LobbyPlayer{{Name: "Me"}, {Name: "You"}, {Name: "Them"}, {Name: "P4"}, {Name: "P5"}, {Name: "P6"}, {Name: "P7"}, {Name: "P8"}} {
-	// 	if _, err := g1.AddPlayer(p); err != nil {
-	// 		log.Error(err)
-	// 	}
-	// 	g1.PlayerEvent(p, &hi.MessageFromPlayer{
-	// 		Type: "ToggleReady",
-	// 	})
-	// }
-	// if err := g1.StartGame(); err != nil {
-	// 	log.Error(err)
-	// }
-	// g1.EndGame()
-	// if _, err := h.AddGame(g1); err != nil {
-	// 	log.Error(err)
-	// }
-	// if _, err := h.AddGame(g2); err != nil {
-	// 	log.Error(err)
-	// }
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+func httpRouteHandler(s gsinterfaces.Server, a *accounts.Accounts, t *tokens, host string, port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, validUser := userCookieHandler(w, r)
 		if !validUser {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 	})
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		u, validUser := userCookieHandler(w, r)
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		u, c, validUser := t.authenticate(w, r)
 		if !validUser {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		websocketHandler(w, r, u, s)
+		if ws := websocketHandler(w, r, u, s); ws != nil && c != nil {
+			t.track(c, ws)
+		}
 	})
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), nil)
-	if err != nil {
-		log.Fatal(err)
+	lt := newLoginThrottle(loginFailures, loginWindow)
+	accountRoutes(mux, s, a, lt)
+	tokenRoutes(mux, t, a, lt)
+	return &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", host, port),
+		Handler: mux,
 	}
 }
 
-func websocketHandler(w http.ResponseWriter, r *http.Request, uuid string, s gsinterfaces.Server) {
-	// Upgrade normal http request into a websocket session
-	ws, err := upgrader.Upgrade(w, r, nil)
+// websocketHandler upgrades the request & connects it to the user, returning the websocket if that went well
+func websocketHandler(w http.ResponseWriter, r *http.Request, uuid string, s gsinterfaces.Server) *websocket.Conn {
+	// Upgrade normal http request into a websocket session, the handshake is written straight to the
+	// connection so the renewed cookie has to be handed over or it's lost
+	ws, err := upgrader.Upgrade(w, r, http.Header{"Set-Cookie": w.Header()["Set-Cookie"]})
 	if err != nil {
 		log.Println(err)
-		return
+		return nil
 	}
 
 	// Add some default websocket parameters
 	ws.SetReadLimit(maxMessageSize)
 	if err := ws.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		log.Error(err)
-		return
+		return nil
 	}
 	ws.SetPongHandler(func(string) error {
 		return ws.SetReadDeadline(time.Now().Add(pongWait))
 	})
 
-	u := s.GetUser(uuid, "")
-	if err := u.AddConnection(ws); err != nil {
+	if err := s.Connect(uuid, ws); err != nil {
 		log.Error(err)
-		return
+		code := websocket.CloseServiceRestart
+		if err == server.ErrBanned {
+			code = websocket.ClosePolicyViolation
+		}
+		msg := websocket.FormatCloseMessage(code, err.Error())
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		ws.Close()
+		return nil
 	}
+	return ws
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminPassword(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "from env")
+	if p, err := adminPassword(""); err != nil || p != "from env" {
+		t.Fatalf("got %q %v", p, err)
+	}
+	file := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := adminPassword(file); err != nil || p != "from file" {
+		t.Fatalf("got %q %v", p, err)
+	}
+	if _, err := adminPassword(file + ".missing"); err == nil {
+		t.Fatal("read a password from a missing file")
+	}
+	t.Setenv("ADMIN_PASSWORD", "")
+	if _, err := adminPassword(""); err == nil {
+		t.Fatal("went without a password")
+	}
+}
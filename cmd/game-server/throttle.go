@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How many failed logins a client address gets per window before being turned away
+const (
+	loginFailures = 10
+	loginWindow   = 15 * time.Minute
+)
+
+// loginThrottle counts failed logins per client address in fixed windows, so passwords can't be guessed
+// faster than a handful per window from any one place. Failures aren't counted per username, otherwise
+// anyone could lock an account out by failing to log in as it.
+type loginThrottle struct {
+	mtx      sync.Mutex
+	limit    int
+	window   time.Duration
+	failures map[string]*failureWindow
+}
+
+type failureWindow struct {
+	start time.Time
+	count int
+}
+
+func newLoginThrottle(limit int, window time.Duration) *loginThrottle {
+	return &loginThrottle{
+		limit:    limit,
+		window:   window,
+		failures: make(map[string]*failureWindow),
+	}
+}
+
+// clientAddress is what a login attempt is counted against
+func clientAddress(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// retryAfter is how long until addr may try again, 0 if it may now
+func (t *loginThrottle) retryAfter(addr string, now time.Time) time.Duration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	fw, ok := t.failures[addr]
+	if !ok || fw.count < t.limit {
+		return 0
+	}
+	if d := fw.start.Add(t.window).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// failed counts a failed login against addr, forgetting the windows that are over on the way
+func (t *loginThrottle) failed(addr string, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for k, fw := range t.failures {
+		if !now.Before(fw.start.Add(t.window)) {
+			delete(t.failures, k)
+		}
+	}
+	fw, ok := t.failures[addr]
+	if !ok {
+		fw = &failureWindow{start: now}
+		t.failures[addr] = fw
+	}
+	fw.count++
+}
+
+// allow answers 429 with a Retry-After header if the client has failed to log in too often lately
+func (t *loginThrottle) allow(w http.ResponseWriter, addr string) bool {
+	wait := t.retryAfter(addr, time.Now())
+	if wait <= 0 {
+		return true
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds()+0.5)))
+	http.Error(w, "too many failed logins, try again later", http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/server"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	lt := newLoginThrottle(2, time.Minute)
+	now := time.Now()
+	lt.failed("a", now)
+	if d := lt.retryAfter("a", now); d != 0 {
+		t.Fatalf("throttled after one failure for %s", d)
+	}
+	lt.failed("a", now)
+	if d := lt.retryAfter("a", now.Add(10*time.Second)); d != 50*time.Second {
+		t.Fatalf("got %s", d)
+	}
+	if d := lt.retryAfter("b", now); d != 0 {
+		t.Fatal("throttled an address that never failed")
+	}
+	if d := lt.retryAfter("a", now.Add(time.Minute)); d != 0 {
+		t.Fatal("still throttled once the window was over")
+	}
+
+	// Windows that are over are forgotten the next time a failure is counted
+	lt.failed("c", now.Add(time.Minute))
+	if len(lt.failures) != 1 {
+		t.Fatalf("kept %d windows", len(lt.failures))
+	}
+}
+
+func TestLoginRoutesAreThrottledPerAddress(t *testing.T) {
+	store := storage.NewMemory()
+	a := accounts.New(store)
+	for _, u := range []string{"alice", "bob"} {
+		if _, err := a.Register(u, "correct horse", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	mux := http.NewServeMux()
+	c := server.DefaultConfig()
+	c.Store = store
+	c.Accounts = a
+	lt := newLoginThrottle(3, time.Minute)
+	accountRoutes(mux, server.New(c), a, lt)
+	tokenRoutes(mux, newTestTokens(time.Hour), a, lt)
+
+	post := func(path, from, username, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+		r.RemoteAddr = from + ":1234"
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := post("/login", "192.0.2.1", "alice", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d got %d", i, w.Code)
+		}
+	}
+	w := post("/token", "192.0.2.1", "bob", "correct horse")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("the address wasn't throttled, got %d", w.Code)
+	}
+	// Failing as alice from one address mustn't lock her out everywhere else
+	if w := post("/token", "192.0.2.2", "Alice", "correct horse"); w.Code != http.StatusOK {
+		t.Fatalf("the account was locked out, got %d", w.Code)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The subprotocol a websocket client offers alongside its token when it can't set an Authorization header
+const bearerProtocol = "bearer"
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// claims are what a bearer token vouches for
+type claims struct {
+	ID      string `json:"id"`
+	UserID  string `json:"user_id"`
+	Expires int64  `json:"expires"`
+}
+
+// tokens hands out bearer tokens for clients that can't keep cookies. They're signed & encrypted with
+// the cookie keys, so rotating those also rotates these.
+type tokens struct {
+	codecs []securecookie.Codec
+	ttl    time.Duration
+	store  storage.Store
+	// Websockets opened with each token, so revoking it can close them
+	smtx     sync.Mutex
+	sessions map[string]*tokenSessions
+}
+
+type tokenSessions struct {
+	expires time.Time
+	conns   []*websocket.Conn
+}
+
+func newTokens(pairs [][]byte, ttl time.Duration, store storage.Store) *tokens {
+	t := &tokens{
+		codecs:   securecookie.CodecsFromPairs(pairs...),
+		ttl:      ttl,
+		store:    store,
+		sessions: make(map[string]*tokenSessions),
+	}
+	for _, codec := range t.codecs {
+		sc := codec.(*securecookie.SecureCookie)
+		// Expiry is down to the claims, not how long ago the token was signed
+		sc.MaxAge(0)
+		sc.SetSerializer(securecookie.JSONEncoder{})
+	}
+	return t
+}
+
+// issue returns a new token for a user along with when it expires. The padding is left off so the token
+// is also a valid Sec-WebSocket-Protocol value.
+func (t *tokens) issue(userID string) (string, time.Time, error) {
+	expires := time.Now().Add(t.ttl)
+	c := &claims{
+		ID:      uuid.Must(uuid.NewV4()).String(),
+		UserID:  userID,
+		Expires: expires.Unix(),
+	}
+	s, err := securecookie.EncodeMulti("token", c, t.codecs...)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return strings.TrimRight(s, "="), expires, nil
+}
+
+// verify checks a token hasn't been tampered with, expired or revoked
+func (t *tokens) verify(token string) (*claims, error) {
+	if n := len(token) % 4; n != 0 {
+		token += strings.Repeat("=", 4-n)
+	}
+	c := &claims{}
+	if err := securecookie.DecodeMulti("token", token, c, t.codecs...); err != nil {
+		return nil, errInvalidToken
+	}
+	if time.Now().Unix() > c.Expires {
+		return nil, errInvalidToken
+	}
+	revoked, err := t.store.TokenRevoked(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errInvalidToken
+	}
+	return c, nil
+}
+
+// revoke revokes a token & closes every websocket opened with it
+func (t *tokens) revoke(c *claims) error {
+	if err := t.store.RevokeToken(c.ID, time.Unix(c.Expires, 0)); err != nil {
+		return err
+	}
+	t.smtx.Lock()
+	ts := t.sessions[c.ID]
+	delete(t.sessions, c.ID)
+	t.smtx.Unlock()
+	if ts != nil {
+		for _, ws := range ts.conns {
+			closeRevoked(ws)
+		}
+	}
+	return nil
+}
+
+// track remembers a websocket was opened with a token, forgetting the tokens that expired on the way. A
+// token revoked while the websocket was being set up has it closed straight away.
+func (t *tokens) track(c *claims, ws *websocket.Conn) {
+	now := time.Now()
+	t.smtx.Lock()
+	for id, ts := range t.sessions {
+		if now.After(ts.expires) {
+			delete(t.sessions, id)
+		}
+	}
+	ts, ok := t.sessions[c.ID]
+	if !ok {
+		ts = &tokenSessions{expires: time.Unix(c.Expires, 0)}
+		t.sessions[c.ID] = ts
+	}
+	ts.conns = append(ts.conns, ws)
+	t.smtx.Unlock()
+	if revoked, err := t.store.TokenRevoked(c.ID); err != nil {
+		log.Error(err)
+	} else if revoked {
+		closeRevoked(ws)
+	}
+}
+
+func closeRevoked(ws *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token revoked")
+	ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	ws.Close()
+}
+
+// bearerToken finds a token in the Authorization header, or in the subprotocols a websocket client
+// offers as "bearer, <token>".
+func bearerToken(r *http.Request) (string, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:]), true
+		}
+		return "", false
+	}
+	ps := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := range ps {
+		ps[i] = strings.TrimSpace(ps[i])
+	}
+	for i, p := range ps {
+		if p == bearerProtocol && len(ps) == 2 {
+			return ps[1-i], true
+		}
+	}
+	return "", false
+}
+
+// authenticate works out who's making a request, from a bearer token when there is one and the userid
+// cookie otherwise. The token's claims are returned as well, nil for cookies.
+func (t *tokens) authenticate(w http.ResponseWriter, r *http.Request) (string, *claims, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		u, ok := userCookieHandler(w, r)
+		return u, nil, ok
+	}
+	c, err := t.verify(token)
+	if err != nil {
+		if err != errInvalidToken {
+			log.Error(err)
+		}
+		return "", nil, false
+	}
+	return c.UserID, c, true
+}
+
+// tokenRoutes adds /token, which issues a token for the account whose credentials are posted, the user
+// of the userid cookie or else a new guest, and /token/revoke, which revokes the token it's called with.
+// Failed logins count against lt, the same as they do for /login.
+func tokenRoutes(mux *http.ServeMux, t *tokens, a *accounts.Accounts, lt *loginThrottle) {
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, ok := userCookie(r)
+		if r.ContentLength != 0 {
+			c, ok := readCredentials(w, r)
+			if !ok {
+				return
+			}
+			addr := clientAddress(r)
+			if !lt.allow(w, addr) {
+				return
+			}
+			acct, err := a.Login(c.Username, c.Password)
+			switch err {
+			case nil:
+			case accounts.ErrInvalidCredentials:
+				lt.failed(addr, time.Now())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			default:
+				log.Error(err)
+				http.Error(w, "unable to issue a token right now", http.StatusInternalServerError)
+				return
+			}
+			userID = acct.UserID
+		} else if !ok {
+			userID = uuid.Must(uuid.NewV4()).String()
+		}
+		token, expires, err := t.issue(userID)
+		if err != nil {
+			log.Error(err)
+			http.Error(w, "unable to issue a token right now", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"token":   token,
+			"user_id": userID,
+			"expires": expires,
+		})
+	})
+	mux.HandleFunc("/token/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "expected an Authorization: Bearer header", http.StatusBadRequest)
+			return
+		}
+		c, err := t.verify(token)
+		if err != nil {
+			http.Error(w, errInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := t.revoke(c); err != nil {
+			log.Error(err)
+			http.Error(w, "unable to revoke the token right now", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/accounts"
+	"github.com/GregoryDosh/game-server/pkg/server"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	"github.com/gorilla/websocket"
+)
+
+func newTestTokens(ttl time.Duration) *tokens {
+	kf := &keyFile{Keys: []keyPair{newKeyPair()}}
+	return newTokens(kf.pairs(), ttl, storage.NewMemory())
+}
+
+func TestTokens(t *testing.T) {
+	tk := newTestTokens(time.Hour)
+	token, expires, err := tk.issue("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(token, "= ,") {
+		t.Fatalf("%q isn't a valid subprotocol", token)
+	}
+	if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("expires in %s", d)
+	}
+	c, err := tk.verify(token)
+	if err != nil || c.UserID != "user" || c.Expires != expires.Unix() {
+		t.Fatalf("got %+v %v", c, err)
+	}
+
+	other, _, _ := tk.issue("user")
+	if err := tk.revoke(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tk.verify(token); err != errInvalidToken {
+		t.Fatalf("a revoked token got %v", err)
+	}
+	if _, err := tk.verify(other); err != nil {
+		t.Fatal("revoking a token revoked another one for the same user")
+	}
+}
+
+func TestTokensRejected(t *testing.T) {
+	tk := newTestTokens(time.Hour)
+	token, _, _ := tk.issue("user")
+	b := []byte(token)
+	b[len(b)/2] ^= 1
+	for name, s := range map[string]string{
+		"tampered": string(b),
+		"garbage":  "not a token",
+		"signed by another key": func() string {
+			s, _, _ := newTestTokens(time.Hour).issue("user")
+			return s
+		}(),
+		"expired": func() string {
+			s, _, _ := newTestTokens(-time.Minute).issue("user")
+			return s
+		}(),
+	} {
+		if _, err := tk.verify(s); err != errInvalidToken {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for _, c := range []struct {
+		header, value, token string
+		ok                   bool
+	}{
+		{"Authorization", "Bearer abc", "abc", true},
+		{"Authorization", "bearer  abc ", "abc", true},
+		{"Authorization", "Basic abc", "", false},
+		{"Authorization", "Bearer", "", false},
+		{"Sec-WebSocket-Protocol", "bearer, abc", "abc", true},
+		{"Sec-WebSocket-Protocol", "abc,bearer", "abc", true},
+		{"Sec-WebSocket-Protocol", "bearer", "", false},
+		{"Sec-WebSocket-Protocol", "bearer, abc, chat", "", false},
+		{"Sec-WebSocket-Protocol", "chat, abc", "", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set(c.header, c.value)
+		token, ok := bearerToken(r)
+		if token != c.token || ok != c.ok {
+			t.Errorf("%s: %q got %q %v", c.header, c.value, token, ok)
+		}
+	}
+}
+
+func TestTokenRoutes(t *testing.T) {
+	useCookieKeys(t, &keyFile{Keys: []keyPair{newKeyPair()}})
+	tk := newTestTokens(time.Hour)
+	a := accounts.New(tk.store)
+	acct, err := a.Register("alice", "password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	tokenRoutes(mux, tk, a, newLoginThrottle(loginFailures, loginWindow))
+
+	issue := func(body string) (string, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", body, w.Code, w.Body)
+		}
+		resp := struct {
+			Token  string `json:"token"`
+			UserID string `json:"user_id"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Token, resp.UserID
+	}
+
+	token, userID := issue(`{"username":"alice","password":"password"}`)
+	if userID != acct.UserID {
+		t.Fatalf("got a token for %s, want %s", userID, acct.UserID)
+	}
+	if _, guest := issue(""); guest == "" || guest == acct.UserID {
+		t.Fatalf("got guest %q", guest)
+	}
+
+	revoke := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/token/revoke", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := revoke(); code != http.StatusNoContent {
+		t.Fatalf("got %d", code)
+	}
+	if code := revoke(); code != http.StatusUnauthorized {
+		t.Fatalf("revoked a token twice, got %d", code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, _, ok := tk.authenticate(httptest.NewRecorder(), r); ok {
+		t.Fatal("authenticated with a revoked token")
+	}
+}
+
+func TestRevokeClosesSessions(t *testing.T) {
+	tk := newTestTokens(time.Hour)
+	c := server.DefaultConfig()
+	c.Store = tk.store
+	s := server.New(c)
+	defer s.Shutdown(0)
+	ts := httptest.NewServer(httpRouteHandler(s, accounts.New(tk.store), tk, "", 0).Handler)
+	defer ts.Close()
+
+	token, _, err := tk.issue("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+token)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest(http.MethodPost, ts.URL+"/token/revoke", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d", resp.StatusCode)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("got %v", err)
+			}
+			break
+		}
+	}
+	tk.smtx.Lock()
+	defer tk.smtx.Unlock()
+	if len(tk.sessions) != 0 {
+		t.Fatalf("still tracking %d tokens", len(tk.sessions))
+	}
+}
@@ -0,0 +1,129 @@
+// Package accounts lets users register a username & password, so who they are no longer depends on a
+// single browser's cookie. Users that never register carry on as guests.
+package accounts
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Limits on passwords, bcrypt ignores anything past 72 bytes
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var (
+	ErrInvalidUsername    = errors.New("usernames are 3 to 32 letters, digits, '_' or '-'")
+	ErrInvalidPassword    = errors.New("passwords are 8 to 72 characters")
+	ErrUsernameTaken      = errors.New("username is taken")
+	ErrInvalidCredentials = errors.New("wrong username or password")
+)
+
+var validUsername = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+// Normalize returns the username an account is stored under, usernames don't care about case or
+// surrounding spaces.
+func Normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+type Accounts struct {
+	store storage.Store
+}
+
+func New(store storage.Store) *Accounts {
+	return &Accounts{store: store}
+}
+
+// Register creates an account for the user with guestID, so everything they've done as a guest carries
+// over. A new user is made up when guestID is empty or already belongs to another account.
+func (a *Accounts) Register(username, password, guestID string) (*storage.Account, error) {
+	username = Normalize(username)
+	if !validUsername.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	acct := &storage.Account{
+		Username:     username,
+		PasswordHash: hash,
+		Created:      time.Now(),
+	}
+	err = errHasAccount
+	if guestID != "" {
+		err = a.create(acct, guestID)
+	}
+	if err == errHasAccount {
+		err = a.create(acct, uuid.Must(uuid.NewV4()).String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("user '%s' registered account '%s'", acct.UserID, username)
+	return acct, nil
+}
+
+var errHasAccount = errors.New("user already has an account")
+
+// create stores acct as the account of the user with id & links their profile to it. It's all done as one
+// profile update so two registrations can't both claim the same guest.
+func (a *Accounts) create(acct *storage.Account, id string) error {
+	return a.store.UpdateUser(id, func(p *storage.UserProfile) error {
+		if p.Account != "" {
+			return errHasAccount
+		}
+		acct.UserID = id
+		switch err := a.store.CreateAccount(acct); err {
+		case nil:
+		case storage.ErrExists:
+			return ErrUsernameTaken
+		default:
+			return err
+		}
+		if p.Created.IsZero() {
+			p.Created = acct.Created
+		}
+		p.Name = acct.Username
+		p.Account = acct.Username
+		return nil
+	})
+}
+
+// Login checks a username & password, returning the account they belong to
+func (a *Accounts) Login(username, password string) (*storage.Account, error) {
+	acct, err := a.store.LoadAccount(Normalize(username))
+	switch err {
+	case nil:
+	case storage.ErrNotFound:
+		// Spend as long as a real check would so usernames can't be probed by timing
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(acct.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return acct, nil
+}
+
+// Taken reports whether name, used as a display name, would pass for someone else's account
+func (a *Accounts) Taken(name, userID string) bool {
+	acct, err := a.store.LoadAccount(Normalize(name))
+	return err == nil && acct.UserID != userID
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
@@ -0,0 +1,119 @@
+package accounts
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/storage"
+)
+
+func TestRegister(t *testing.T) {
+	store := storage.NewMemory()
+	a := New(store)
+	for _, c := range []struct {
+		username, password string
+		err                error
+	}{
+		{"ab", "password", ErrInvalidUsername},
+		{"no spaces", "password", ErrInvalidUsername},
+		{strings.Repeat("a", 33), "password", ErrInvalidUsername},
+		{"alice", "short", ErrInvalidPassword},
+		{"alice", strings.Repeat("p", 73), ErrInvalidPassword},
+	} {
+		if _, err := a.Register(c.username, c.password, ""); err != c.err {
+			t.Errorf("%q %q: got %v, want %v", c.username, c.password, err, c.err)
+		}
+	}
+
+	acct, err := a.Register(" Alice ", "password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Username != "alice" || acct.UserID == "" || string(acct.PasswordHash) == "password" {
+		t.Fatalf("got %+v", acct)
+	}
+	if _, err := a.Register("ALICE", "password", ""); err != ErrUsernameTaken {
+		t.Fatalf("got %v", err)
+	}
+	p, err := store.LoadUser(acct.UserID)
+	if err != nil || p.Account != "alice" || p.Name != "alice" {
+		t.Fatalf("got %+v %v", p, err)
+	}
+}
+
+func TestRegisterKeepsGuest(t *testing.T) {
+	store := storage.NewMemory()
+	a := New(store)
+	if err := store.SaveUser(&storage.UserProfile{ID: "guest", Name: "guest name", Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	acct, err := a.Register("alice", "password", "guest")
+	if err != nil || acct.UserID != "guest" {
+		t.Fatalf("got %+v %v", acct, err)
+	}
+	// A guest that already has an account can't have a second one linked to it
+	acct, err = a.Register("bob", "password", "guest")
+	if err != nil || acct.UserID == "guest" {
+		t.Fatalf("got %+v %v", acct, err)
+	}
+}
+
+func TestRegisterClaimsGuestOnce(t *testing.T) {
+	store := storage.NewMemory()
+	a := New(store)
+	var wg sync.WaitGroup
+	ids := make([]string, 2)
+	for i, username := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func(i int, username string) {
+			defer wg.Done()
+			acct, err := a.Register(username, "password", "guest")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = acct.UserID
+		}(i, username)
+	}
+	wg.Wait()
+	if (ids[0] == "guest") == (ids[1] == "guest") {
+		t.Fatalf("got users %v", ids)
+	}
+	p, err := store.LoadUser("guest")
+	if err != nil || p.Account == "" || p.Account != p.Name {
+		t.Fatalf("got %+v %v", p, err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	a := New(storage.NewMemory())
+	registered, err := a.Register("alice", "password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := a.Login(" ALICE", "password")
+	if err != nil || acct.UserID != registered.UserID {
+		t.Fatalf("got %+v %v", acct, err)
+	}
+	for _, c := range [][2]string{{"alice", "wrong password"}, {"nobody", "password"}} {
+		if _, err := a.Login(c[0], c[1]); err != ErrInvalidCredentials {
+			t.Errorf("%v: got %v", c, err)
+		}
+	}
+}
+
+func TestTaken(t *testing.T) {
+	a := New(storage.NewMemory())
+	acct, err := a.Register("alice", "password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Taken("Alice", "someone else") {
+		t.Fatal("someone else passed for alice")
+	}
+	if a.Taken("alice", acct.UserID) || a.Taken("bob", "someone else") {
+		t.Fatal("got taken for a name that's free to use")
+	}
+}
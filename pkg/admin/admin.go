@@ -0,0 +1,96 @@
+// Package admin serves a read only view of a running server for operators: JSON endpoints for its
+// users, games & event counters and a dashboard showing them. It's meant for its own listener, away
+// from the port players connect to.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
+	log "github.com/Sirupsen/logrus"
+)
+
+// The username the dashboard asks for, only the password matters
+const username = "admin"
+
+// Handler serves the dashboard at / along with:
+//
+//	GET /api/users   every user with their connections & outbound queue
+//	GET /api/games   every game that hasn't been closed yet
+//	GET /api/events  how often each event was handled & how that went
+//	GET /metrics     every metric in the Prometheus text format
+//
+// Every request needs HTTP basic auth with the password, which is only accepted over TLS or from localhost
+// so it's never sent across a network in the clear.
+func Handler(s gsinterfaces.Server, password string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboard))
+	})
+	mux.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Users())
+	})
+	mux.HandleFunc("/api/games", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Games())
+	})
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.EventStats())
+	})
+	mux.Handle("/metrics", metrics.Handler(s.WriteMetrics))
+	return authenticate(password, mux)
+}
+
+// Loopback reports whether addr, a host:port or bare host, only reaches this machine. An empty host listens
+// on every interface so it doesn't.
+func Loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func authenticate(password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil && !Loopback(r.RemoteAddr) {
+			http.Error(w, "the admin API is only served over HTTPS or to localhost", http.StatusForbidden)
+			return
+		}
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			if ok {
+				log.Warnf("failed admin login from %s", r.RemoteAddr)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="game-server admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
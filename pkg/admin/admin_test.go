@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/server"
+)
+
+func TestLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"localhost:9090": true,
+		"127.0.0.1:9090": true,
+		"[::1]:9090":     true,
+		"127.0.0.1":      true,
+		":9090":          false,
+		"0.0.0.0:9090":   false,
+		"192.0.2.1:9090": false,
+		"example.com:80": false,
+	} {
+		if got := Loopback(addr); got != want {
+			t.Errorf("%s: got %v", addr, got)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	h := Handler(server.New(server.DefaultConfig()), "secret")
+	for _, c := range []struct {
+		name, method, from, password string
+		tls                          bool
+		code                         int
+	}{
+		{"no password", http.MethodGet, "127.0.0.1:1234", "", false, http.StatusUnauthorized},
+		{"wrong password", http.MethodGet, "127.0.0.1:1234", "wrong", false, http.StatusUnauthorized},
+		{"localhost", http.MethodGet, "127.0.0.1:1234", "secret", false, http.StatusOK},
+		{"in the clear", http.MethodGet, "192.0.2.1:1234", "secret", false, http.StatusForbidden},
+		{"over TLS", http.MethodGet, "192.0.2.1:1234", "secret", true, http.StatusOK},
+		{"not a GET", http.MethodPost, "127.0.0.1:1234", "secret", false, http.StatusMethodNotAllowed},
+	} {
+		r := httptest.NewRequest(c.method, "/api/users", nil)
+		r.RemoteAddr = c.from
+		if c.password != "" {
+			r.SetBasicAuth(username, c.password)
+		}
+		if c.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s: got %d, want %d", c.name, w.Code, c.code)
+		}
+	}
+}
+
+func TestMetricsIncludeTheServers(t *testing.T) {
+	h := Handler(server.New(server.DefaultConfig()), "secret")
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.SetBasicAuth(username, "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	for _, name := range []string{"gameserver_users_connected", "gameserver_websocket_messages_sent_total"} {
+		if !strings.Contains(w.Body.String(), "# TYPE "+name+" ") {
+			t.Errorf("%s is missing", name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package admin
+
+// dashboard polls the JSON endpoints and renders them as tables, it's kept dependency free so the
+// binary is all that's needed to run it.
+const dashboard = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>game-server admin</title>
+<style>
+  body { font-family: sans-serif; margin: 1.5em; color: #222; }
+  h1 { font-size: 1.4em; }
+  h2 { font-size: 1.1em; margin-top: 1.5em; }
+  table { border-collapse: collapse; width: 100%; }
+  th, td { text-align: left; padding: 0.25em 0.75em; border-bottom: 1px solid #ddd; font-size: 0.9em; }
+  th { background: #f4f4f4; }
+  td.num { text-align: right; font-variant-numeric: tabular-nums; }
+  .muted { color: #888; }
+  #error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>game-server admin</h1>
+<p class="muted">Refreshes every 5 seconds. <span id="updated"></span> <span id="error"></span></p>
+
+<h2>Users <span class="muted" id="users-count"></span></h2>
+<table>
+  <thead><tr><th>Name</th><th>ID</th><th>Account</th><th>Role</th><th>Connections</th>
+  <th>Queue depth</th><th>Sent</th><th>Dropped</th><th>Coalesced</th><th>Slow disconnects</th></tr></thead>
+  <tbody id="users"></tbody>
+</table>
+
+<h2>Games <span class="muted" id="games-count"></span></h2>
+<table>
+  <thead><tr><th>Name</th><th>ID</th><th>Type</th><th>Status</th><th>Players</th><th>Spectators</th><th>Created</th></tr></thead>
+  <tbody id="games"></tbody>
+</table>
+
+<h2>Events</h2>
+<table>
+  <thead><tr><th>Event</th><th>Calls</th><th>Errors</th><th>Average time</th></tr></thead>
+  <tbody id="events"></tbody>
+</table>
+
+<script>
+function cell(text, num) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  if (num) { td.className = "num"; }
+  return td;
+}
+
+function fill(id, rows, cells) {
+  var body = document.getElementById(id);
+  body.innerHTML = "";
+  rows.forEach(function (r) {
+    var tr = document.createElement("tr");
+    cells(r).forEach(function (c) { tr.appendChild(c); });
+    body.appendChild(tr);
+  });
+}
+
+function get(path) {
+  return fetch(path, { credentials: "same-origin" }).then(function (r) {
+    if (!r.ok) { throw new Error(path + ": " + r.status); }
+    return r.json();
+  });
+}
+
+function refresh() {
+  Promise.all([get("api/users"), get("api/games"), get("api/events")]).then(function (res) {
+    var users = res[0], games = res[1], events = res[2];
+    var names = {};
+    users.forEach(function (u) { names[u.id] = u.name; });
+    var named = function (ids) { return (ids || []).map(function (id) { return names[id] || id; }).join(", "); };
+
+    document.getElementById("users-count").textContent = "(" + users.length + ")";
+    fill("users", users, function (u) {
+      return [cell(u.name), cell(u.id), cell(u.account || ""), cell(u.role), cell(u.connections, true),
+        cell(u.queue.depth, true), cell(u.queue.sent, true), cell(u.queue.dropped, true),
+        cell(u.queue.coalesced, true), cell(u.queue.slow_disconnects, true)];
+    });
+    document.getElementById("games-count").textContent = "(" + games.length + ")";
+    fill("games", games, function (g) {
+      return [cell(g.name), cell(g.id), cell(g.type), cell(g.status),
+        cell((g.players || []).length + "/" + g.capacity + " " + named(g.players)),
+        cell(named(g.spectators)), cell(new Date(g.created).toLocaleString())];
+    });
+    fill("events", events, function (e) {
+      var avg = e.calls ? (e.time_ns / e.calls / 1e6).toFixed(2) + " ms" : "";
+      return [cell(e.event), cell(e.calls, true), cell(e.errors, true), cell(avg, true)];
+    });
+    document.getElementById("updated").textContent = "Last updated " + new Date().toLocaleTimeString() + ".";
+    document.getElementById("error").textContent = "";
+  }).catch(function (err) {
+    document.getElementById("error").textContent = err.message;
+  });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -9,8 +9,11 @@ import (
 )
 
 type General struct {
-	Event   string
-	Payload map[string]interface{}
+	Event     string
+	RequestID string
+	Payload   map[string]interface{}
+	// Data is the payload decoded into the struct registered for Event, filled in by Decode
+	Data interface{}
 }
 
 // Looking to be able to quickly split/send message event types/channels to the respective modules and marshalling everything else into a map.
@@ -26,6 +29,9 @@ func (g *General) MarshalJSON() ([]byte, error) {
 	for k, v := range g.Payload {
 		e[k] = v
 	}
+	if g.RequestID != "" {
+		e["request_id"] = g.RequestID
+	}
 	if b, err := json.Marshal(e); err == nil {
 		return b, nil
 	}
@@ -41,6 +47,12 @@ func (g *General) UnmarshalJSON(b []byte) error {
 		g.Payload = map[string]interface{}{}
 	}
 	for k, v := range m {
+		if k == "request_id" {
+			if id, ok := v.(string); ok {
+				g.RequestID = id
+				continue
+			}
+		}
 		if k == "event" {
 			if e, ok := m["event"].(string); ok {
 				events := strings.Split(e, ":")
@@ -57,11 +69,15 @@ func (g *General) UnmarshalJSON(b []byte) error {
 }
 
 func WrapError(err error) []byte {
+	payload := map[string]interface{}{
+		"error": err.Error(),
+	}
+	if verr, ok := err.(*ValidationError); ok {
+		payload["fields"] = verr.Fields
+	}
 	msg, merr := json.Marshal(&General{
-		Event: "ERROR",
-		Payload: map[string]interface{}{
-			"error": err.Error(),
-		},
+		Event:   "ERROR",
+		Payload: payload,
 	})
 	if merr != nil {
 		log.Errorf("error wrapping err.Error() %s", err.Error())
@@ -85,3 +101,31 @@ func WrapValues(t string, keyvalues map[string]interface{}) []byte {
 func WrapValue(t string, key, value string) []byte {
 	return WrapValues(t, map[string]interface{}{key: value})
 }
+
+// WithSequence stamps an already wrapped message with the sequence number it was sent under
+func WithSequence(b []byte, seq uint64) []byte {
+	if len(b) < 2 || b[0] != '{' {
+		return b
+	}
+	stamped := []byte(fmt.Sprintf(`{"seq":%d`, seq))
+	if len(b) > 2 {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, b[1:]...)
+}
+
+// WithRequestID stamps an already wrapped message with the request_id of the request it answers
+func WithRequestID(b []byte, id string) []byte {
+	if len(b) < 2 || b[0] != '{' || id == "" {
+		return b
+	}
+	encoded, err := json.Marshal(id)
+	if err != nil {
+		return b
+	}
+	stamped := append([]byte(`{"request_id":`), encoded...)
+	if len(b) > 2 {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, b[1:]...)
+}
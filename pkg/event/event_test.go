@@ -0,0 +1,44 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGeneralRequestID(t *testing.T) {
+	g := &General{}
+	if err := json.Unmarshal([]byte(`{"event":"GAME:VOTE","request_id":"r1","id":"g"}`), g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Event != "GAME" || g.RequestID != "r1" || g.Payload["event"] != "VOTE" || g.Payload["id"] != "g" {
+		t.Fatalf("got %+v", g)
+	}
+	if _, ok := g.Payload["request_id"]; ok {
+		t.Fatal("request_id left in the payload")
+	}
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil || m["request_id"] != "r1" {
+		t.Fatalf("got %s, %v", b, err)
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	for _, c := range []struct {
+		in, id, want string
+	}{
+		{`{"event":"ACK"}`, "r1", `{"request_id":"r1","event":"ACK"}`},
+		{`{}`, "r1", `{"request_id":"r1"}`},
+		{`{"event":"ACK"}`, "", `{"event":"ACK"}`},
+		{`{}`, `"quoted"`, `{"request_id":"\"quoted\""}`},
+		{`[]`, "r1", `[]`},
+	} {
+		if got := string(WithRequestID([]byte(c.in), c.id)); got != c.want {
+			t.Errorf("WithRequestID(%s, %q) = %s, want %s", c.in, c.id, got, c.want)
+		}
+	}
+}
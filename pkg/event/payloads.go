@@ -0,0 +1,90 @@
+package event
+
+// Payloads of every event a client can send to the server
+
+type Broadcast struct {
+	Message string `json:"message" validate:"required,min=1,max=500"`
+}
+
+type CreateGame struct {
+	Type    string                 `json:"type" validate:"required,min=1"`
+	Name    string                 `json:"name" validate:"max=64"`
+	Options map[string]interface{} `json:"options"`
+}
+
+type ListGameTypes struct{}
+
+type ListGames struct{}
+
+// GameRef points at an existing game, used by JOIN_GAME, LEAVE_GAME, SPECTATE_GAME, END_GAME &
+// DELETE_GAME
+type GameRef struct {
+	ID string `json:"id" validate:"required,min=1"`
+}
+
+type Resume struct {
+	LastSeq uint64 `json:"last_seq" validate:"required"`
+}
+
+// Game is a player action forwarded to a game. Everything besides the id and type is game specific
+// and handed to the game untouched.
+type Game struct {
+	ID   string `json:"id" validate:"required,min=1"`
+	Type string `json:"type" validate:"required,min=1"`
+}
+
+type ChangeUsername struct {
+	Name string `json:"name" validate:"required,min=1,max=32"`
+}
+
+// GetGameLog asks for the history of a game that's over. A step above zero also replays the game up to
+// that step of its log.
+type GetGameLog struct {
+	ID   string `json:"id" validate:"required,min=1"`
+	Step int    `json:"step" validate:"min=0"`
+}
+
+type GetStats struct{}
+
+// Admin & moderator events
+
+type ListUsers struct{}
+
+// UserRef points at a user, used by KICK_USER, BAN_USER & UNBAN_USER. The reason is passed on to them
+// in the close frame, which has room for 123 bytes of it.
+type UserRef struct {
+	ID     string `json:"id" validate:"required,min=1"`
+	Reason string `json:"reason" validate:"max=123"`
+}
+
+type Announce struct {
+	Message string `json:"message" validate:"required,min=1,max=1000"`
+}
+
+type SetRole struct {
+	ID   string `json:"id" validate:"required,min=1"`
+	Role string `json:"role" validate:"required,enum=player|moderator|admin"`
+}
+
+func init() {
+	Register("BROADCAST", Broadcast{})
+	Register("CREATE_GAME", CreateGame{})
+	Register("LIST_GAME_TYPES", ListGameTypes{})
+	Register("LIST_GAMES", ListGames{})
+	Register("JOIN_GAME", GameRef{})
+	Register("LEAVE_GAME", GameRef{})
+	Register("SPECTATE_GAME", GameRef{})
+	Register("RESUME", Resume{})
+	Register("GAME", Game{})
+	Register("CHANGE_USERNAME", ChangeUsername{})
+	Register("GET_GAME_LOG", GetGameLog{})
+	Register("GET_STATS", GetStats{})
+	Register("LIST_USERS", ListUsers{})
+	Register("KICK_USER", UserRef{})
+	Register("BAN_USER", UserRef{})
+	Register("UNBAN_USER", UserRef{})
+	Register("END_GAME", GameRef{})
+	Register("DELETE_GAME", GameRef{})
+	Register("ANNOUNCE", Announce{})
+	Register("SET_ROLE", SetRole{})
+}
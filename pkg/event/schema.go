@@ -0,0 +1,278 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Payload structs describe what each event carries through `json` tags and are checked against
+// `validate` tags, a comma separated list of:
+//
+//	required   the key has to be present
+//	min=N      minimum string length or number value
+//	max=N      maximum string length or number value
+//	enum=A|B   the value has to be one of the listed strings
+var (
+	schemamtx sync.RWMutex
+	schemas   = map[string]reflect.Type{}
+)
+
+// FieldError is a single problem with one field of a payload
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists everything wrong with an event's payload
+type ValidationError struct {
+	Event  string
+	Fields []FieldError
+}
+
+func (v *ValidationError) Error() string {
+	reasons := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		reasons = append(reasons, fmt.Sprintf("'%s' %s", f.Field, f.Reason))
+	}
+	return fmt.Sprintf("invalid '%s' payload: %s", v.Event, strings.Join(reasons, ", "))
+}
+
+// Register declares the payload struct for an event. It panics if the event is registered twice or the
+// payload isn't a struct.
+func Register(name string, payload interface{}) {
+	t := reflect.TypeOf(payload)
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("event: payload for '%s' must be a struct", name))
+	}
+	schemamtx.Lock()
+	defer schemamtx.Unlock()
+	if _, ok := schemas[name]; ok {
+		panic(fmt.Sprintf("event: Register called twice for '%s'", name))
+	}
+	schemas[name] = t
+}
+
+// Registered reports whether an event has been declared with Register
+func Registered(name string) bool {
+	schemamtx.RLock()
+	defer schemamtx.RUnlock()
+	_, ok := schemas[name]
+	return ok
+}
+
+// Decode turns the payload of an event into its registered struct, validates it & stores it in Data.
+func Decode(g *General) error {
+	schemamtx.RLock()
+	t, ok := schemas[g.Event]
+	schemamtx.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown event '%s'", g.Event)
+	}
+
+	v := reflect.New(t)
+	b, err := json.Marshal(g.Payload)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			return &ValidationError{Event: g.Event, Fields: []FieldError{{
+				Field:  te.Field,
+				Reason: "must be " + article(jsonType(te.Type)),
+			}}}
+		}
+		return &ValidationError{Event: g.Event, Fields: []FieldError{{Reason: err.Error()}}}
+	}
+
+	verr := &ValidationError{Event: g.Event}
+	for _, f := range fields(t) {
+		val := v.Elem().FieldByIndex(f.index)
+		if _, present := g.Payload[f.name]; !present {
+			if f.required {
+				verr.Fields = append(verr.Fields, FieldError{Field: f.name, Reason: "is required"})
+			}
+			continue
+		}
+		if reason := f.check(val); reason != "" {
+			verr.Fields = append(verr.Fields, FieldError{Field: f.name, Reason: reason})
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	g.Data = v.Interface()
+	return nil
+}
+
+// JSONSchema describes the payload of every registered event as a JSON Schema document.
+func JSONSchema() ([]byte, error) {
+	schemamtx.RLock()
+	names := make([]string, 0, len(schemas))
+	for n := range schemas {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	definitions := map[string]interface{}{}
+	oneOf := []interface{}{}
+	for _, n := range names {
+		definitions[n] = eventSchema(n, schemas[n])
+		oneOf = append(oneOf, map[string]string{"$ref": "#/definitions/" + n})
+	}
+	schemamtx.RUnlock()
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "game-server events",
+		"definitions": definitions,
+		"oneOf":       oneOf,
+	}, "", "  ")
+}
+
+func eventSchema(name string, t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{
+		"event":      map[string]interface{}{"const": name},
+		"request_id": map[string]interface{}{"type": "string"},
+	}
+	required := []string{"event"}
+	for _, f := range fields(t) {
+		properties[f.name] = f.schema()
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+type field struct {
+	name     string
+	index    []int
+	kind     reflect.Type
+	required bool
+	min      *float64
+	max      *float64
+	enum     []string
+}
+
+func fields(t reflect.Type) []field {
+	fs := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := field{name: name, index: sf.Index, kind: sf.Type}
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			kv := strings.SplitN(rule, "=", 2)
+			switch kv[0] {
+			case "required":
+				f.required = true
+			case "min", "max":
+				n, err := strconv.ParseFloat(kv[1], 64)
+				if err != nil {
+					panic(fmt.Sprintf("event: bad %s rule on '%s': %s", kv[0], name, err))
+				}
+				if kv[0] == "min" {
+					f.min = &n
+				} else {
+					f.max = &n
+				}
+			case "enum":
+				f.enum = strings.Split(kv[1], "|")
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// check returns why a decoded value breaks the field's rules, or an empty string if it doesn't.
+func (f field) check(v reflect.Value) string {
+	var size float64
+	unit := ""
+	switch v.Kind() {
+	case reflect.String:
+		size = float64(len([]rune(v.String())))
+		unit = " characters"
+		if len(f.enum) > 0 {
+			ok := false
+			for _, e := range f.enum {
+				ok = ok || e == v.String()
+			}
+			if !ok {
+				return fmt.Sprintf("must be one of %s", strings.Join(f.enum, ", "))
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	default:
+		return ""
+	}
+	if f.min != nil && size < *f.min {
+		return fmt.Sprintf("must be at least %v%s", *f.min, unit)
+	}
+	if f.max != nil && size > *f.max {
+		return fmt.Sprintf("must be at most %v%s", *f.max, unit)
+	}
+	return ""
+}
+
+func (f field) schema() map[string]interface{} {
+	s := map[string]interface{}{"type": jsonType(f.kind)}
+	minKey, maxKey := "minimum", "maximum"
+	if f.kind.Kind() == reflect.String {
+		minKey, maxKey = "minLength", "maxLength"
+	}
+	if f.min != nil {
+		s[minKey] = *f.min
+	}
+	if f.max != nil {
+		s[maxKey] = *f.max
+	}
+	if len(f.enum) > 0 {
+		s["enum"] = f.enum
+	}
+	return s
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+func article(jsonType string) string {
+	switch jsonType {
+	case "integer", "array", "object":
+		return "an " + jsonType
+	}
+	return "a " + jsonType
+}
@@ -0,0 +1,151 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testPayload struct {
+	Name  string `json:"name" validate:"required,min=2,max=5"`
+	Count int    `json:"count" validate:"min=1,max=3"`
+	Color string `json:"color" validate:"enum=red|blue"`
+}
+
+func init() {
+	Register("TEST_PAYLOAD", testPayload{})
+}
+
+func decode(t *testing.T, msg string) (*General, error) {
+	t.Helper()
+	g := &General{}
+	if err := json.Unmarshal([]byte(msg), g); err != nil {
+		t.Fatal(err)
+	}
+	return g, Decode(g)
+}
+
+func TestDecode(t *testing.T) {
+	g, err := decode(t, `{"event":"TEST_PAYLOAD","name":"abc","count":2,"color":"red"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := g.Data.(*testPayload)
+	if !ok || p.Name != "abc" || p.Count != 2 || p.Color != "red" {
+		t.Fatalf("got %#v", g.Data)
+	}
+	// Optional fields are only checked when they're present
+	if _, err := decode(t, `{"event":"TEST_PAYLOAD","name":"abc"}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeValidation(t *testing.T) {
+	for _, c := range []struct {
+		msg, field, reason string
+	}{
+		{`{"event":"TEST_PAYLOAD"}`, "name", "is required"},
+		{`{"event":"TEST_PAYLOAD","name":"a"}`, "name", "must be at least 2 characters"},
+		{`{"event":"TEST_PAYLOAD","name":"abcdef"}`, "name", "must be at most 5 characters"},
+		{`{"event":"TEST_PAYLOAD","name":"ééé"}`, "", ""},
+		{`{"event":"TEST_PAYLOAD","name":"abc","count":0}`, "count", "must be at least 1"},
+		{`{"event":"TEST_PAYLOAD","name":"abc","count":4}`, "count", "must be at most 3"},
+		{`{"event":"TEST_PAYLOAD","name":"abc","color":"green"}`, "color", "must be one of red, blue"},
+		{`{"event":"TEST_PAYLOAD","name":7}`, "name", "must be a string"},
+		{`{"event":"TEST_PAYLOAD","name":"abc","count":"two"}`, "count", "must be an integer"},
+	} {
+		g, err := decode(t, c.msg)
+		if c.field == "" {
+			if err != nil {
+				t.Errorf("%s: %s", c.msg, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: got %v, want a ValidationError", c.msg, err)
+			continue
+		}
+		if verr.Event != "TEST_PAYLOAD" || len(verr.Fields) != 1 || verr.Fields[0] != (FieldError{Field: c.field, Reason: c.reason}) {
+			t.Errorf("%s: got %+v", c.msg, verr)
+		}
+		if g.Data != nil {
+			t.Errorf("%s: invalid payload decoded", c.msg)
+		}
+	}
+}
+
+func TestDecodeListsEveryField(t *testing.T) {
+	_, err := decode(t, `{"event":"TEST_PAYLOAD","count":9,"color":"green"}`)
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Fields) != 3 {
+		t.Fatalf("got %v", err)
+	}
+	want := `invalid 'TEST_PAYLOAD' payload: 'name' is required, 'count' must be at most 3, 'color' must be one of red, blue`
+	if verr.Error() != want {
+		t.Fatalf("got %s", verr.Error())
+	}
+}
+
+func TestDecodeUnknownEvent(t *testing.T) {
+	if _, err := decode(t, `{"event":"NOT_REGISTERED"}`); err == nil || err.Error() != "unknown event 'NOT_REGISTERED'" {
+		t.Fatalf("got %v", err)
+	}
+	if Registered("NOT_REGISTERED") || !Registered("TEST_PAYLOAD") {
+		t.Fatal("Registered disagrees with Register")
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	for name, payload := range map[string]interface{}{
+		"TEST_PAYLOAD": testPayload{},
+		"NOT_A_STRUCT": "payload",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %s didn't panic", name)
+				}
+			}()
+			Register(name, payload)
+		}()
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Definitions map[string]struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+			Required   []string                          `json:"required"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := doc.Definitions["TEST_PAYLOAD"]
+	if !ok {
+		t.Fatalf("TEST_PAYLOAD missing from %s", b)
+	}
+	if d.Properties["event"]["const"] != "TEST_PAYLOAD" || d.Properties["request_id"]["type"] != "string" {
+		t.Fatalf("got %v", d.Properties)
+	}
+	name := d.Properties["name"]
+	if name["type"] != "string" || name["minLength"] != float64(2) || name["maxLength"] != float64(5) {
+		t.Fatalf("got name %v", name)
+	}
+	if count := d.Properties["count"]; count["type"] != "integer" || count["minimum"] != float64(1) || count["maximum"] != float64(3) {
+		t.Fatalf("got count %v", count)
+	}
+	if color := d.Properties["color"]; len(color["enum"].([]interface{})) != 2 {
+		t.Fatalf("got color %v", color)
+	}
+	if len(d.Required) != 2 || d.Required[0] != "event" || d.Required[1] != "name" {
+		t.Fatalf("got required %v", d.Required)
+	}
+	if _, ok := doc.Definitions["CREATE_GAME"]; !ok {
+		t.Fatal("events declared in payloads.go are missing")
+	}
+}
@@ -0,0 +1,64 @@
+package games
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventLog is the ordered history of a game. Inputs are written by the game's Loop and outputs by the
+// game as it sends them, while anyone may read it.
+type EventLog struct {
+	mtx     sync.RWMutex
+	clock   Clock
+	entries []gsinterfaces.LogEntry
+}
+
+func NewEventLog(clock Clock) *EventLog {
+	return &EventLog{clock: clock}
+}
+
+// Entries copies the log so far
+func (l *EventLog) Entries() []gsinterfaces.LogEntry {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return append([]gsinterfaces.LogEntry{}, l.entries...)
+}
+
+// input logs an input about to be handled and returns the mark to truncate back to if it's rejected
+func (l *EventLog) input(in gsinterfaces.Input) int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	mark := len(l.entries)
+	l.entries = append(l.entries, gsinterfaces.LogEntry{
+		Seq:   mark + 1,
+		At:    l.clock.Now(),
+		Input: &in,
+	})
+	return mark
+}
+
+func (l *EventLog) truncate(mark int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.entries = l.entries[:mark]
+}
+
+// Output logs what the game sent. It's stored encoded since the game may still change whatever the
+// output points at.
+func (l *EventLog) Output(o *gsinterfaces.GameOutput) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		log.Errorf("unable to log game output: %s", err)
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.entries = append(l.entries, gsinterfaces.LogEntry{
+		Seq:    len(l.entries) + 1,
+		At:     l.clock.Now(),
+		Output: b,
+	})
+}
@@ -0,0 +1,94 @@
+package games
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// ErrGameStopped is returned for input submitted to a game that has been shut down
+var ErrGameStopped = errors.New("game has stopped")
+
+// Loop feeds a game its inputs one at a time on a single goroutine. A game runs its handler through
+// Run and never touches its state from anywhere else. Every input that's handled without an error is
+// written to the game's log.
+type Loop struct {
+	log      *EventLog
+	inputs   chan loopInput
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type loopInput struct {
+	in    gsinterfaces.Input
+	reply chan error
+}
+
+// NewLoop creates a loop that can hold size inputs waiting to be processed
+func NewLoop(size int, log *EventLog) *Loop {
+	return &Loop{
+		log:    log,
+		inputs: make(chan loopInput, size),
+		done:   make(chan struct{}),
+	}
+}
+
+// Submit queues an input and waits for the loop to process it
+func (l *Loop) Submit(in gsinterfaces.Input) error {
+	li := loopInput{in: in, reply: make(chan error, 1)}
+	select {
+	case l.inputs <- li:
+	case <-l.done:
+		return ErrGameStopped
+	}
+	select {
+	case err := <-li.reply:
+		return err
+	case <-l.done:
+		return ErrGameStopped
+	}
+}
+
+// post queues an input without waiting on the result
+func (l *Loop) post(in gsinterfaces.Input) {
+	select {
+	case l.inputs <- loopInput{in: in, reply: make(chan error, 1)}:
+	case <-l.done:
+	}
+}
+
+// Run hands every input to handle until the loop is stopped. A panic in handle is left for whoever
+// runs the loop to recover.
+func (l *Loop) Run(handle func(in gsinterfaces.Input) error) {
+	for {
+		select {
+		case li := <-l.inputs:
+			mark := l.log.input(li.in)
+			err := handle(li.in)
+			if err != nil {
+				l.log.truncate(mark)
+			}
+			li.reply <- err
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Replay handles an input on the calling goroutine and logs it like Run would. It's only meant for
+// bringing a game back from a snapshot before its loop is started.
+func (l *Loop) Replay(handle func(in gsinterfaces.Input) error, in gsinterfaces.Input) error {
+	mark := l.log.input(in)
+	err := handle(in)
+	if err != nil {
+		l.log.truncate(mark)
+	}
+	return err
+}
+
+func (l *Loop) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
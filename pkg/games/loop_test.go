@@ -0,0 +1,112 @@
+package games
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+func TestLoopRunsOneInputAtATime(t *testing.T) {
+	l := NewLoop(10, NewEventLog(NewManualClock(testStart)))
+	running, most := 0, 0
+	var mtx sync.Mutex
+	go l.Run(func(gsinterfaces.Input) error {
+		mtx.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mtx.Unlock()
+		time.Sleep(time.Millisecond)
+		mtx.Lock()
+		running--
+		mtx.Unlock()
+		return nil
+	})
+	defer l.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Fatalf("%d inputs were handled at once", most)
+	}
+	if n := len(l.log.Entries()); n != 20 {
+		t.Fatalf("logged %d inputs", n)
+	}
+}
+
+func TestLoopLogsOnlyAcceptedInputs(t *testing.T) {
+	log := NewEventLog(NewManualClock(testStart))
+	l := NewLoop(10, log)
+	rejected := errors.New("rejected")
+	go l.Run(func(in gsinterfaces.Input) error {
+		if in.User == "bad" {
+			return rejected
+		}
+		return nil
+	})
+	defer l.Stop()
+
+	if err := l.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: "good"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: "bad"}); err != rejected {
+		t.Fatalf("got %v", err)
+	}
+	entries := log.Entries()
+	if len(entries) != 1 || entries[0].Input.User != "good" || entries[0].Seq != 1 {
+		t.Fatalf("got %+v", entries)
+	}
+}
+
+func TestLoopStop(t *testing.T) {
+	l := NewLoop(10, NewEventLog(NewManualClock(testStart)))
+	stopped := make(chan struct{})
+	go func() {
+		l.Run(func(gsinterfaces.Input) error { return nil })
+		close(stopped)
+	}()
+	l.Stop()
+	l.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return")
+	}
+	if err := l.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction}); err != ErrGameStopped {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestGameTimeout(t *testing.T) {
+	m := startedTable(t, 5)
+	stopped := make(chan struct{})
+	go func() {
+		m.Run()
+		close(stopped)
+	}()
+	m.clock.(*ManualClock).Advance(mooseGameTimeout)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the game kept running after timing out")
+	}
+	if m.Status() != gsinterfaces.GameFinished {
+		t.Fatalf("status %s", m.Status())
+	}
+	if r := m.Result(); r == nil || r.Outcome != "the game timed out" || len(r.Winners) != 0 {
+		t.Fatalf("got result %+v", r)
+	}
+}
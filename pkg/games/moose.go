@@ -1,31 +1,250 @@
 package games
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
 	log "github.com/Sirupsen/logrus"
-	namesgenerator "github.com/moby/moby/pkg/namesgenerator"
-	uuid "github.com/satori/go.uuid"
 )
 
+const mooseType = "MOOSE"
+
+// Secret Moose table limits and win thresholds
+const (
+	mooseMinPlayers         = 5
+	mooseMaxPlayers         = 10
+	mooseLiberalTrack       = 5
+	mooseFascistTrack       = 6
+	mooseElectionTracker    = 3
+	mooseMooseElectableAt   = 3
+	mooseVetoUnlockedAt     = 5
+	mooseLiberalPolicyCount = 6
+	mooseFascistPolicyCount = 11
+)
+
+// Roles, teams & policies
+const (
+	roleLiberal = "LIBERAL"
+	roleFascist = "FASCIST"
+	roleMoose   = "MOOSE"
+
+	policyLiberal = "LIBERAL"
+	policyFascist = "FASCIST"
+)
+
+// Phases the table moves through
+const (
+	phaseLobby                 = "LOBBY"
+	phaseNomination            = "NOMINATION"
+	phaseElection              = "ELECTION"
+	phaseLegislativePresident  = "LEGISLATIVE_PRESIDENT"
+	phaseLegislativeChancellor = "LEGISLATIVE_CHANCELLOR"
+	phaseExecutiveAction       = "EXECUTIVE_ACTION"
+	phaseGameOver              = "GAME_OVER"
+)
+
+// Presidential powers granted by the fascist track
+const (
+	powerNone            = ""
+	powerPolicyPeek      = "POLICY_PEEK"
+	powerInvestigate     = "INVESTIGATE_LOYALTY"
+	powerSpecialElection = "SPECIAL_ELECTION"
+	powerExecution       = "EXECUTION"
+)
+
+// Timers the table runs
+const (
+	timerTurn           = "TURN"
+	timerGameTimeout    = "GAME_TIMEOUT"
+	mooseGameTimeout    = 2 * time.Hour
+	mooseCountdownEvery = 10 * time.Second
+)
+
+var mooseGameType = &Type{
+	Name:        mooseType,
+	DisplayName: "Secret Moose",
+	MinPlayers:  mooseMinPlayers,
+	MaxPlayers:  mooseMaxPlayers,
+	Options: []Option{
+		{
+			Name:        "max_players",
+			Description: "How many seats the table has",
+			Type:        OptionInt,
+			Default:     mooseMaxPlayers,
+			Min:         mooseMinPlayers,
+			Max:         mooseMaxPlayers,
+		},
+		{
+			Name:        "turn_seconds",
+			Description: "Seconds a player gets to act before a default action is taken for them, 0 for no limit",
+			Type:        OptionInt,
+			Default:     0,
+			Min:         0,
+			Max:         600,
+		},
+	},
+}
+
+func init() {
+	mooseGameType.New = func(name string, options map[string]interface{}, env Env) (gsinterfaces.Game, error) {
+		return NewMoose(name, options, env), nil
+	}
+	mooseGameType.Restore = restoreMoose
+	Register(mooseGameType)
+}
+
+// mooseFascists is how many fascists (not counting the moose) sit at a table of a given size.
+var mooseFascists = map[int]int{5: 1, 6: 1, 7: 2, 8: 2, 9: 3, 10: 3}
+
+// moosePowers returns the power granted when the n-th fascist policy is enacted at a table of the given size.
+func moosePowers(players, n int) string {
+	var track [mooseFascistTrack]string
+	switch {
+	case players <= 6:
+		track = [mooseFascistTrack]string{powerNone, powerNone, powerPolicyPeek, powerExecution, powerExecution, powerNone}
+	case players <= 8:
+		track = [mooseFascistTrack]string{powerNone, powerInvestigate, powerSpecialElection, powerExecution, powerExecution, powerNone}
+	default:
+		track = [mooseFascistTrack]string{powerInvestigate, powerInvestigate, powerSpecialElection, powerExecution, powerExecution, powerNone}
+	}
+	if n < 1 || n > len(track) {
+		return powerNone
+	}
+	return track[n-1]
+}
+
+type moosePlayer struct {
+	id           string
+	role         string
+	alive        bool
+	investigated bool
+	// left is set when the player walks away from a finished game, their seat stays for the record
+	left bool
+	// Secrets only this player has learned, surfaced through their private view
+	investigations map[string]string
+	peek           []string
+}
+
+func (p *moosePlayer) team() string {
+	if p.role == roleLiberal {
+		return roleLiberal
+	}
+	return roleFascist
+}
+
 type moose struct {
-	fromGameHandler func(useruuid string, gameuuid string, e interface{})
+	fromGameHandler func(gameuuid string, o *gsinterfaces.GameOutput)
 	profilemtx      sync.RWMutex
 	name            string
 	id              string
-	gameEvents      chan []byte
+	loop            *Loop
+	log             *EventLog
+	clock           Clock
+	metadata        gsinterfaces.GameMetadata
+	summarymtx      sync.RWMutex
+	summary         mooseSummary
+
+	// Everything below is table state and only ever touched from the game's loop
+	rng             *rand.Rand
+	timers          *Timers
+	phase           string
+	pregame         *Pregame
+	players         []*moosePlayer
+	spectators      []string
+	president       int
+	resumeAfter     int
+	nominee         int
+	chancellor      int
+	lastPresident   int
+	lastChancellor  int
+	votes           map[string]bool
+	lastVotes       map[string]bool
+	drawPile        []string
+	discardPile     []string
+	hand            []string
+	liberalTrack    int
+	fascistTrack    int
+	electionTracker int
+	vetoRequested   bool
+	vetoDenied      bool
+	pendingPower    string
+	lastPolicy      string
+	lastChaos       bool
+	winner          string
+	winReason       string
+
+	// What the turn timer was last set for, see turnKey
+	armedTurn string
+
+	// Private messages for users who won't be part of the next state's audience
+	notices map[string]interface{}
+}
+
+// mooseSummary is what the server can read about the table from outside the loop
+type mooseSummary struct {
+	status     string
+	capacity   int
+	players    []string
+	spectators []string
+	result     *gsinterfaces.GameResult
 }
 
 type gameError struct {
-	UserID string `json:"gameid"`
-	Error  string `json:"error"`
+	Type    string `json:"type"`
+	Message string `json:"error"`
+}
+
+func (e *gameError) Error() string {
+	return e.Message
 }
 
-type readyToggled struct {
-	UserID string `json:"userid"`
+type moosePublicPlayer struct {
+	ID    string `json:"id"`
+	Ready bool   `json:"ready"`
+	Alive bool   `json:"alive"`
+	Role  string `json:"role,omitempty"`
+}
+
+type mooseState struct {
+	Type            string                 `json:"type"`
+	Phase           string                 `json:"phase"`
+	Host            string                 `json:"host,omitempty"`
+	Options         map[string]interface{} `json:"options"`
+	Players         []moosePublicPlayer    `json:"players"`
+	President       string                 `json:"president,omitempty"`
+	Nominee         string                 `json:"nominee,omitempty"`
+	Chancellor      string                 `json:"chancellor,omitempty"`
+	LastPresident   string                 `json:"last_president,omitempty"`
+	LastChancellor  string                 `json:"last_chancellor,omitempty"`
+	Voted           []string               `json:"voted,omitempty"`
+	LastVotes       map[string]bool        `json:"last_votes,omitempty"`
+	LiberalTrack    int                    `json:"liberal_policies"`
+	FascistTrack    int                    `json:"fascist_policies"`
+	LastPolicy      string                 `json:"last_policy,omitempty"`
+	LastChaos       bool                   `json:"last_policy_chaos,omitempty"`
+	ElectionTracker int                    `json:"election_tracker"`
+	DrawPile        int                    `json:"draw_pile"`
+	DiscardPile     int                    `json:"discard_pile"`
+	VetoUnlocked    bool                   `json:"veto_unlocked"`
+	VetoRequested   bool                   `json:"veto_requested"`
+	PendingPower    string                 `json:"pending_power,omitempty"`
+	Deadline        *time.Time             `json:"deadline,omitempty"`
+	Winner          string                 `json:"winner,omitempty"`
+	WinReason       string                 `json:"win_reason,omitempty"`
+}
+
+// mooseView is the private overlay each seated player receives alongside the public state.
+type mooseView struct {
+	Role           string            `json:"role,omitempty"`
+	Team           string            `json:"team,omitempty"`
+	Teammates      map[string]string `json:"teammates,omitempty"`
+	Hand           []string          `json:"hand,omitempty"`
+	Peek           []string          `json:"peek,omitempty"`
+	Investigations map[string]string `json:"investigations,omitempty"`
 }
 
 func (m *moose) ID() string {
@@ -40,62 +259,1049 @@ func (m *moose) Name() string {
 	return m.name
 }
 
-func (m *moose) SetFromGameHandler(h func(u string, g string, e interface{})) {
+func (m *moose) SetFromGameHandler(h func(g string, o *gsinterfaces.GameOutput)) {
 	if h != nil {
 		m.fromGameHandler = h
 	}
 }
 
-func (m *moose) FromUserHandler(u string, p map[string]interface{}) {
+func (m *moose) Type() string {
+	return mooseType
+}
+
+func (m *moose) Status() string {
+	m.summarymtx.RLock()
+	defer m.summarymtx.RUnlock()
+	return m.summary.status
+}
+
+func (m *moose) Capacity() int {
+	m.summarymtx.RLock()
+	defer m.summarymtx.RUnlock()
+	return m.summary.capacity
+}
+
+func (m *moose) Players() []string {
+	m.summarymtx.RLock()
+	defer m.summarymtx.RUnlock()
+	return append([]string{}, m.summary.players...)
+}
+
+func (m *moose) Spectators() []string {
+	m.summarymtx.RLock()
+	defer m.summarymtx.RUnlock()
+	return append([]string{}, m.summary.spectators...)
+}
+
+func (m *moose) Metadata() gsinterfaces.GameMetadata {
+	m.profilemtx.RLock()
+	defer m.profilemtx.RUnlock()
+	return m.metadata
+}
+
+func (m *moose) Log() []gsinterfaces.LogEntry {
+	return m.log.Entries()
+}
+
+func (m *moose) Result() *gsinterfaces.GameResult {
+	m.summarymtx.RLock()
+	defer m.summarymtx.RUnlock()
+	return m.summary.result
+}
+
+func (m *moose) Snapshot() ([]byte, error) {
+	return snapshotLog(m.Metadata(), m.log)
+}
+
+func (m *moose) Submit(in gsinterfaces.Input) error {
+	return m.loop.Submit(in)
+}
+
+// Run processes the table's inputs until the game is shut down or has gone on for too long
+func (m *moose) Run() {
+	m.loop.Run(m.process)
+	m.timers.CancelAll()
+}
+
+func (m *moose) process(in gsinterfaces.Input) error {
+	switch in.Kind {
+	case gsinterfaces.InputJoin:
+		return m.update(func() error { return m.join(in.User) })
+	case gsinterfaces.InputLeave:
+		return m.update(func() error { return m.leave(in.User) })
+	case gsinterfaces.InputSpectate:
+		return m.update(func() error { return m.spectate(in.User) })
+	case gsinterfaces.InputUnspectate:
+		return m.update(func() error {
+			if !m.unspectate(in.User) {
+				return errors.New("not spectating")
+			}
+			return nil
+		})
+	case gsinterfaces.InputResync:
+		m.resync(in.User)
+		return nil
+	case gsinterfaces.InputAction:
+		return m.action(in.User, in.Payload)
+	case gsinterfaces.InputTimer:
+		return m.timer(in)
+	}
+	return fmt.Errorf("unknown input '%s'", in.Kind)
+}
+
+func (m *moose) join(u string) error {
+	if err := m.requirePhase(phaseLobby); err != nil {
+		return err
+	}
+	if err := m.pregame.Join(u); err != nil {
+		return err
+	}
+	m.unspectate(u)
+	return nil
+}
+
+func (m *moose) spectate(u string) error {
+	if m.isSeated(u) {
+		return errors.New("already seated")
+	}
+	for _, s := range m.spectators {
+		if s == u {
+			return errors.New("already spectating")
+		}
+	}
+	m.spectators = append(m.spectators, u)
+	return nil
+}
+
+// resync sends the current state to a single member of the table, e.g. after they lost messages.
+func (m *moose) resync(u string) {
+	o := m.stateOutput()
+	if !gsinterfaces.Contains(o.Audience, u) {
+		return
+	}
+	r := &gsinterfaces.GameOutput{
+		Audience: []string{u},
+		Public:   o.Public,
+	}
+	if p, ok := o.Private[u]; ok {
+		r.Private = map[string]interface{}{u: p}
+	}
+	m.emit(r)
+}
+
+// action applies a player's action, rejecting anything the rules don't allow right now.
+func (m *moose) action(u string, p map[string]interface{}) error {
 	log.Debugf("event from %s: %s", u, p)
 	t, ok := p["type"]
 	if !ok {
-		m.fromGameHandler(u, "INVALID_EVENT", &gameError{
-			Error: "type missing from keys",
-		})
+		return &gameError{
+			Type:    "INVALID_EVENT",
+			Message: "type missing from keys",
+		}
+	}
+	err := m.update(func() error {
+		return m.handle(u, t, p)
+	})
+	if _, ok := err.(*gameError); err != nil && !ok {
+		err = &gameError{
+			Type:    "INVALID_ACTION",
+			Message: err.Error(),
+		}
+	}
+	return err
+}
+
+func (m *moose) timer(in gsinterfaces.Input) error {
+	name, kind, remaining, ok := m.timers.Fired(in)
+	if !ok {
+		return nil
+	}
+	switch {
+	case name == timerGameTimeout:
+		log.Warnf("game %s timed out", m.Name())
+		if m.phase != phaseGameOver {
+			// Ended first so the server sees the game finish instead of one stuck in progress
+			m.update(func() error {
+				m.endGame("", "the game timed out")
+				return nil
+			})
+		}
+		m.loop.Stop()
+	case kind == TimerCountdown:
+		m.countdown(name, remaining)
+	default:
+		return m.update(m.expireTurn)
+	}
+	return nil
+}
+
+// countdown lets the table know how long the current turn has left. It's sent as a transient
+// message so it never takes the place of a state update.
+func (m *moose) countdown(name string, remaining time.Duration) {
+	m.emit(&gsinterfaces.GameOutput{
+		Audience: m.stateOutput().Audience,
+		Public: map[string]interface{}{
+			"type":      "COUNTDOWN",
+			"timer":     name,
+			"remaining": int(remaining.Round(time.Second).Seconds()),
+		},
+		Transient: true,
+	})
+}
+
+// turnKey names what the table is waiting on, the turn timer restarts whenever it changes.
+func (m *moose) turnKey() string {
+	return fmt.Sprintf("%s/%d/%d/%t/%d/%d/%d", m.phase, m.president, m.nominee, m.vetoRequested,
+		m.electionTracker, m.liberalTrack, m.fascistTrack)
+}
+
+// armTurn keeps the turn timer in step with the table
+func (m *moose) armTurn() {
+	seconds, _ := m.pregame.Options()["turn_seconds"].(int)
+	if seconds == 0 || m.phase == phaseLobby || m.phase == phaseGameOver {
+		m.timers.Cancel(timerTurn)
+		m.armedTurn = ""
 		return
 	}
-	log.Warn(t)
+	if key := m.turnKey(); key != m.armedTurn {
+		m.armedTurn = key
+		m.timers.Set(timerTurn, time.Duration(seconds)*time.Second, mooseCountdownEvery)
+	}
+}
+
+// expireTurn takes the default action for whoever ran out of time: a random eligible nominee,
+// nein for everyone yet to vote, a random policy, turning down a veto or a random target.
+func (m *moose) expireTurn() error {
+	president := m.seatID(m.president)
+	switch m.phase {
+	case phaseNomination:
+		candidates := m.targets(func(i int) bool {
+			return i != m.lastChancellor && (i != m.lastPresident || m.alivePlayers() <= mooseMinPlayers)
+		})
+		if len(candidates) == 0 {
+			m.failedGovernment()
+			return nil
+		}
+		return m.nominate(president, candidates[m.rng.Intn(len(candidates))])
+	case phaseElection:
+		// The last vote settles the election, so who still has to vote is worked out up front
+		waiting := []string{}
+		for _, p := range m.players {
+			if _, voted := m.votes[p.id]; p.alive && !voted {
+				waiting = append(waiting, p.id)
+			}
+		}
+		for _, id := range waiting {
+			if m.phase != phaseElection {
+				break
+			}
+			if err := m.vote(id, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	case phaseLegislativePresident:
+		return m.presidentDiscard(president, m.rng.Intn(len(m.hand)))
+	case phaseLegislativeChancellor:
+		if m.vetoRequested {
+			return m.respondVeto(president, false)
+		}
+		return m.chancellorEnact(m.seatID(m.chancellor), m.rng.Intn(len(m.hand)))
+	case phaseExecutiveAction:
+		f := map[string]func(string, int) error{
+			powerInvestigate:     m.investigate,
+			powerSpecialElection: m.specialElection,
+			powerExecution:       m.execute,
+		}[m.pendingPower]
+		candidates := m.targets(func(i int) bool {
+			return m.pendingPower != powerInvestigate || !m.players[i].investigated
+		})
+		if f == nil || len(candidates) == 0 {
+			m.advancePresidency()
+			return nil
+		}
+		return f(president, candidates[m.rng.Intn(len(candidates))])
+	}
+	return nil
+}
+
+// targets lists the living seats other than the president's that pass the filter
+func (m *moose) targets(ok func(i int) bool) []int {
+	ts := []int{}
+	for i, p := range m.players {
+		if p.alive && i != m.president && ok(i) {
+			ts = append(ts, i)
+		}
+	}
+	return ts
+}
+
+func (m *moose) handle(u string, t interface{}, p map[string]interface{}) error {
+	if !m.isSeated(u) {
+		return errors.New("not seated")
+	}
 	switch t {
 	case "TOGGLE_READY":
-		m.fromGameHandler(u, "TOGGLED_READY", &readyToggled{
-			UserID: u,
+		return m.inLobby(func() error { return m.pregame.ToggleReady(u) })
+	case "KICK_PLAYER":
+		target, err := payloadString(p, "player")
+		if err != nil {
+			return err
+		}
+		return m.inLobby(func() error {
+			if err := m.pregame.Kick(u, target); err != nil {
+				return err
+			}
+			m.notices[target] = &gameError{Type: "KICKED", Message: "removed from the table by the host"}
+			return nil
 		})
-	default:
-		m.fromGameHandler(u, "UNKNOWN_EVENT", &gameError{
-			Error: fmt.Sprintf("unknown type '%s'", t),
+	case "TRANSFER_HOST":
+		target, err := payloadString(p, "player")
+		if err != nil {
+			return err
+		}
+		return m.inLobby(func() error { return m.pregame.TransferHost(u, target) })
+	case "SET_OPTIONS":
+		options, ok := p["options"].(map[string]interface{})
+		if !ok {
+			return errors.New("'options' must be an object")
+		}
+		return m.inLobby(func() error { return m.pregame.SetOptions(u, options) })
+	case "START_GAME":
+		return m.inLobby(func() error {
+			if err := m.pregame.CheckStart(u); err != nil {
+				return err
+			}
+			m.start()
+			return nil
 		})
+	case "NOMINATE":
+		return m.withTarget(u, p, m.nominate)
+	case "VOTE":
+		ja, err := payloadBool(p, "vote")
+		if err != nil {
+			return err
+		}
+		return m.vote(u, ja)
+	case "DISCARD_POLICY":
+		i, err := payloadInt(p, "index")
+		if err != nil {
+			return err
+		}
+		return m.presidentDiscard(u, i)
+	case "ENACT_POLICY":
+		i, err := payloadInt(p, "index")
+		if err != nil {
+			return err
+		}
+		return m.chancellorEnact(u, i)
+	case "PROPOSE_VETO":
+		return m.proposeVeto(u)
+	case "RESPOND_VETO":
+		accept, err := payloadBool(p, "accept")
+		if err != nil {
+			return err
+		}
+		return m.respondVeto(u, accept)
+	case "INVESTIGATE":
+		return m.withTarget(u, p, m.investigate)
+	case "SPECIAL_ELECTION":
+		return m.withTarget(u, p, m.specialElection)
+	case "EXECUTE":
+		return m.withTarget(u, p, m.execute)
+	}
+	return &gameError{
+		Type:    "UNKNOWN_EVENT",
+		Message: fmt.Sprintf("unknown type '%s'", t),
+	}
+}
+
+// update applies a change to the table and, if it succeeded, publishes the new state.
+func (m *moose) update(f func() error) error {
+	if err := f(); err != nil {
+		return err
+	}
+	m.armTurn()
+	o := m.stateOutput()
+	for u, n := range m.notices {
+		o.Private[u] = n
+	}
+	m.notices = map[string]interface{}{}
+	m.summarize()
+	m.emit(o)
+	return nil
+}
+
+// emit logs an output and hands it to the server
+func (m *moose) emit(o *gsinterfaces.GameOutput) {
+	m.log.Output(o)
+	if m.fromGameHandler != nil {
+		m.fromGameHandler(m.ID(), o)
 	}
 }
 
-func (m *moose) StartGameLoop() {
-	timeoutTicker := time.NewTicker(2 * time.Hour)
-	for {
-		select {
-		case e := <-m.gameEvents:
-			log.Errorf("Whoa, event!? %s", e)
-		case <-timeoutTicker.C:
-			log.Error("Game Timed Out")
-			return
+// summarize refreshes what the server can read about the table
+func (m *moose) summarize() {
+	status := gsinterfaces.GameInProgress
+	switch m.phase {
+	case phaseLobby:
+		status = gsinterfaces.GameWaiting
+	case phaseGameOver:
+		status = gsinterfaces.GameFinished
+	}
+	sum := mooseSummary{
+		status:     status,
+		capacity:   m.pregame.Capacity(),
+		players:    m.seated(),
+		spectators: append([]string{}, m.spectators...),
+	}
+	if m.phase == phaseGameOver {
+		sum.result = &gsinterfaces.GameResult{Winners: []string{}, Outcome: m.winReason}
+		for _, p := range m.players {
+			if p.team() == m.winner {
+				sum.result.Winners = append(sum.result.Winners, p.id)
+			}
 		}
 	}
+	m.summarymtx.Lock()
+	m.summary = sum
+	m.summarymtx.Unlock()
 }
 
 func (m *moose) Shutdown() {
 	log.Warnf("Received shutdown notification in game %s", m.Name())
+	m.loop.Stop()
+}
+
+// stateOutput builds the public table state for every seated player and spectator, with each
+// player's own private view on top.
+func (m *moose) stateOutput() *gsinterfaces.GameOutput {
+	s := &mooseState{
+		Type:            "STATE",
+		Phase:           m.phase,
+		Host:            m.pregame.Host(),
+		Options:         m.pregame.Options(),
+		LastVotes:       m.lastVotes,
+		LiberalTrack:    m.liberalTrack,
+		FascistTrack:    m.fascistTrack,
+		LastPolicy:      m.lastPolicy,
+		LastChaos:       m.lastChaos,
+		ElectionTracker: m.electionTracker,
+		DrawPile:        len(m.drawPile),
+		DiscardPile:     len(m.discardPile),
+		VetoUnlocked:    m.fascistTrack >= mooseVetoUnlockedAt,
+		VetoRequested:   m.vetoRequested,
+		PendingPower:    m.pendingPower,
+		Winner:          m.winner,
+		WinReason:       m.winReason,
+		President:       m.seatID(m.president),
+		Nominee:         m.seatID(m.nominee),
+		Chancellor:      m.seatID(m.chancellor),
+		LastPresident:   m.seatID(m.lastPresident),
+		LastChancellor:  m.seatID(m.lastChancellor),
+	}
+	if at, ok := m.timers.Deadline(timerTurn); ok {
+		s.Deadline = &at
+	}
+	o := &gsinterfaces.GameOutput{
+		Public:  s,
+		Private: map[string]interface{}{},
+	}
+	if m.phase == phaseLobby {
+		for _, id := range m.pregame.Seats() {
+			s.Players = append(s.Players, moosePublicPlayer{ID: id, Ready: m.pregame.IsReady(id), Alive: true})
+			o.Audience = append(o.Audience, id)
+		}
+	}
+	for _, p := range m.players {
+		pp := moosePublicPlayer{ID: p.id, Ready: true, Alive: p.alive}
+		// Roles only become public knowledge once the game is decided
+		if m.phase == phaseGameOver {
+			pp.Role = p.role
+		}
+		s.Players = append(s.Players, pp)
+		if p.left {
+			continue
+		}
+		o.Audience = append(o.Audience, p.id)
+		o.Private[p.id] = m.viewFor(p)
+	}
+	o.Audience = append(o.Audience, m.spectators...)
+	// Listed in seat order, ranging over the map would make the same game look different every time
+	for _, p := range m.players {
+		if _, ok := m.votes[p.id]; ok {
+			s.Voted = append(s.Voted, p.id)
+		}
+	}
+	return o
+}
+
+func (m *moose) seatID(i int) string {
+	if i < 0 || i >= len(m.players) {
+		return ""
+	}
+	return m.players[i].id
+}
+
+func (m *moose) seat(u string) int {
+	for i, p := range m.players {
+		if p.id == u {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *moose) alivePlayers() int {
+	n := 0
+	for _, p := range m.players {
+		if p.alive {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *moose) requirePhase(phase string) error {
+	if m.phase != phase {
+		return fmt.Errorf("not allowed during phase '%s'", m.phase)
+	}
+	return nil
+}
+
+func (m *moose) requirePresident(u string) error {
+	if m.seat(u) != m.president {
+		return errors.New("only the president can do that")
+	}
+	return nil
+}
+
+// withTarget resolves the 'player' key of the payload to a living seat other than the acting user.
+func (m *moose) withTarget(u string, p map[string]interface{}, f func(u string, target int) error) error {
+	id, err := payloadString(p, "player")
+	if err != nil {
+		return err
+	}
+	t := m.seat(id)
+	if t < 0 {
+		return fmt.Errorf("player '%s' is not seated at this table", id)
+	}
+	if !m.players[t].alive {
+		return fmt.Errorf("player '%s' is no longer in the game", id)
+	}
+	if id == u {
+		return errors.New("cannot target yourself")
+	}
+	return f(u, t)
+}
+
+// seated lists everyone holding a seat, the pregame table until the roles are dealt.
+func (m *moose) seated() []string {
+	if m.phase == phaseLobby {
+		return m.pregame.Seats()
+	}
+	ps := make([]string, 0, len(m.players))
+	for _, p := range m.players {
+		if !p.left {
+			ps = append(ps, p.id)
+		}
+	}
+	return ps
+}
+
+func (m *moose) isSeated(u string) bool {
+	if m.phase == phaseLobby {
+		return m.pregame.IsSeated(u)
+	}
+	i := m.seat(u)
+	return i >= 0 && !m.players[i].left
+}
+
+func (m *moose) inLobby(f func() error) error {
+	if err := m.requirePhase(phaseLobby); err != nil {
+		return err
+	}
+	return f()
+}
+
+// leave gives up a seat. Once roles are dealt players are held to their seat until the game is over.
+func (m *moose) leave(u string) error {
+	if m.phase == phaseLobby {
+		return m.pregame.Leave(u)
+	}
+	if m.phase != phaseGameOver {
+		return errors.New("cannot leave a game in progress")
+	}
+	if !m.isSeated(u) {
+		return errors.New("not seated")
+	}
+	// Seating is frozen once the game is decided so the result & seat indexes stay intact
+	m.players[m.seat(u)].left = true
+	return nil
+}
+
+func (m *moose) unspectate(u string) bool {
+	for i, s := range m.spectators {
+		if s == u {
+			m.spectators = append(m.spectators[:i], m.spectators[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// start deals the game out to the pregame table.
+func (m *moose) start() {
+	for _, u := range m.pregame.Seats() {
+		m.players = append(m.players, &moosePlayer{id: u, alive: true})
+	}
+	n := len(m.players)
+
+	// Seat order & roles are both random
+	m.rng.Shuffle(n, func(i, j int) { m.players[i], m.players[j] = m.players[j], m.players[i] })
+	roles := []string{roleMoose}
+	for i := 0; i < mooseFascists[n]; i++ {
+		roles = append(roles, roleFascist)
+	}
+	for len(roles) < n {
+		roles = append(roles, roleLiberal)
+	}
+	m.rng.Shuffle(n, func(i, j int) { roles[i], roles[j] = roles[j], roles[i] })
+	for i, p := range m.players {
+		p.role = roles[i]
+		p.alive = true
+	}
+
+	m.drawPile = m.drawPile[:0]
+	for i := 0; i < mooseLiberalPolicyCount; i++ {
+		m.drawPile = append(m.drawPile, policyLiberal)
+	}
+	for i := 0; i < mooseFascistPolicyCount; i++ {
+		m.drawPile = append(m.drawPile, policyFascist)
+	}
+	m.rng.Shuffle(len(m.drawPile), func(i, j int) { m.drawPile[i], m.drawPile[j] = m.drawPile[j], m.drawPile[i] })
+
+	m.president = m.rng.Intn(n)
+	m.beginNomination()
+}
+
+// viewFor builds the private overlay for a player. Fascists always know each other and the moose,
+// the moose only knows the fascists at small tables.
+func (m *moose) viewFor(p *moosePlayer) *mooseView {
+	v := &mooseView{
+		Role:           p.role,
+		Team:           p.team(),
+		Peek:           p.peek,
+		Investigations: p.investigations,
+	}
+	if p.role == roleFascist || (p.role == roleMoose && len(m.players) <= 6) {
+		v.Teammates = map[string]string{}
+		for _, o := range m.players {
+			if o != p && o.team() == roleFascist {
+				v.Teammates[o.id] = o.role
+			}
+		}
+	}
+	i := m.seat(p.id)
+	if (m.phase == phaseLegislativePresident && i == m.president) || (m.phase == phaseLegislativeChancellor && i == m.chancellor) {
+		v.Hand = m.hand
+	}
+	return v
+}
+
+func (m *moose) beginNomination() {
+	m.phase = phaseNomination
+	m.nominee = -1
+	m.chancellor = -1
+	m.votes = nil
+	m.hand = nil
+	m.vetoRequested = false
+	m.vetoDenied = false
+	m.pendingPower = powerNone
+}
+
+// advancePresidency passes the presidency clockwise to the next living player, returning to the
+// regular order after a special election.
+func (m *moose) advancePresidency() {
+	from := m.president
+	if m.resumeAfter >= 0 {
+		from = m.resumeAfter
+		m.resumeAfter = -1
+	}
+	n := len(m.players)
+	for i := 1; i <= n; i++ {
+		next := (from + i) % n
+		if m.players[next].alive {
+			m.president = next
+			break
+		}
+	}
+	m.beginNomination()
+}
+
+func (m *moose) nominate(u string, target int) error {
+	if err := m.requirePhase(phaseNomination); err != nil {
+		return err
+	}
+	if err := m.requirePresident(u); err != nil {
+		return err
+	}
+	if target == m.lastChancellor {
+		return errors.New("the last elected chancellor is term limited")
+	}
+	if target == m.lastPresident && m.alivePlayers() > mooseMinPlayers {
+		return errors.New("the last elected president is term limited")
+	}
+	m.nominee = target
+	m.votes = map[string]bool{}
+	m.phase = phaseElection
+	return nil
+}
+
+func (m *moose) vote(u string, ja bool) error {
+	if err := m.requirePhase(phaseElection); err != nil {
+		return err
+	}
+	i := m.seat(u)
+	if i < 0 || !m.players[i].alive {
+		return errors.New("only living players may vote")
+	}
+	if _, ok := m.votes[u]; ok {
+		return errors.New("already voted")
+	}
+	m.votes[u] = ja
+	if len(m.votes) < m.alivePlayers() {
+		return nil
+	}
+
+	yes := 0
+	for _, v := range m.votes {
+		if v {
+			yes++
+		}
+	}
+	m.lastVotes = m.votes
+	m.votes = nil
+	if yes*2 <= m.alivePlayers() {
+		m.failedGovernment()
+		return nil
+	}
+
+	if m.fascistTrack >= mooseMooseElectableAt && m.players[m.nominee].role == roleMoose {
+		m.endGame(roleFascist, "the moose was elected chancellor")
+		return nil
+	}
+	m.chancellor = m.nominee
+	m.lastPresident = m.president
+	m.lastChancellor = m.chancellor
+	m.electionTracker = 0
+	m.hand = m.draw(3)
+	m.phase = phaseLegislativePresident
+	return nil
+}
+
+// failedGovernment moves the election tracker and enacts the top policy once the country is thrown into chaos.
+func (m *moose) failedGovernment() {
+	m.electionTracker++
+	if m.electionTracker < mooseElectionTracker {
+		m.advancePresidency()
+		return
+	}
+	m.electionTracker = 0
+	m.lastPresident = -1
+	m.lastChancellor = -1
+	if m.enact(m.draw(1)[0], true) {
+		return
+	}
+	m.advancePresidency()
+}
+
+func (m *moose) presidentDiscard(u string, i int) error {
+	if err := m.requirePhase(phaseLegislativePresident); err != nil {
+		return err
+	}
+	if err := m.requirePresident(u); err != nil {
+		return err
+	}
+	if i < 0 || i >= len(m.hand) {
+		return fmt.Errorf("invalid policy index %d", i)
+	}
+	m.discardPile = append(m.discardPile, m.hand[i])
+	m.hand = append(append([]string{}, m.hand[:i]...), m.hand[i+1:]...)
+	m.phase = phaseLegislativeChancellor
+	return nil
+}
+
+func (m *moose) chancellorEnact(u string, i int) error {
+	if err := m.requirePhase(phaseLegislativeChancellor); err != nil {
+		return err
+	}
+	if m.seat(u) != m.chancellor {
+		return errors.New("only the chancellor can do that")
+	}
+	if m.vetoRequested {
+		return errors.New("waiting on the president to answer the veto")
+	}
+	if i < 0 || i >= len(m.hand) {
+		return fmt.Errorf("invalid policy index %d", i)
+	}
+	p := m.hand[i]
+	for j, d := range m.hand {
+		if j != i {
+			m.discardPile = append(m.discardPile, d)
+		}
+	}
+	m.hand = nil
+	if m.enact(p, false) {
+		return nil
+	}
+	if p == policyFascist {
+		if power := moosePowers(len(m.players), m.fascistTrack); power != powerNone {
+			m.grantPower(power)
+			return nil
+		}
+	}
+	m.advancePresidency()
+	return nil
+}
+
+func (m *moose) proposeVeto(u string) error {
+	if err := m.requirePhase(phaseLegislativeChancellor); err != nil {
+		return err
+	}
+	if m.seat(u) != m.chancellor {
+		return errors.New("only the chancellor can do that")
+	}
+	if m.fascistTrack < mooseVetoUnlockedAt {
+		return errors.New("veto power is not unlocked yet")
+	}
+	if m.vetoRequested || m.vetoDenied {
+		return errors.New("veto already requested this session")
+	}
+	m.vetoRequested = true
+	return nil
+}
+
+func (m *moose) respondVeto(u string, accept bool) error {
+	if err := m.requirePhase(phaseLegislativeChancellor); err != nil {
+		return err
+	}
+	if err := m.requirePresident(u); err != nil {
+		return err
+	}
+	if !m.vetoRequested {
+		return errors.New("no veto has been requested")
+	}
+	m.vetoRequested = false
+	if !accept {
+		m.vetoDenied = true
+		return nil
+	}
+	m.discardPile = append(m.discardPile, m.hand...)
+	m.hand = nil
+	m.reshuffleIfNeeded()
+	m.failedGovernment()
+	return nil
 }
 
-func NewMoose(name string) *moose {
-	id := uuid.Must(uuid.NewV4()).String()
-	if name == "" {
-		genName := strings.Split(namesgenerator.GetRandomName(0), "_")
-		name = fmt.Sprintf("%s %s", strings.Title(genName[0]), strings.Title(genName[1]))
+// grantPower hands the president an executive action. The policy peek resolves immediately.
+func (m *moose) grantPower(power string) {
+	if power == powerPolicyPeek {
+		m.players[m.president].peek = append([]string{}, m.drawPile[:3]...)
+		m.advancePresidency()
+		return
+	}
+	m.pendingPower = power
+	m.phase = phaseExecutiveAction
+}
+
+func (m *moose) requirePower(u string, power string) error {
+	if err := m.requirePhase(phaseExecutiveAction); err != nil {
+		return err
+	}
+	if err := m.requirePresident(u); err != nil {
+		return err
+	}
+	if m.pendingPower != power {
+		return fmt.Errorf("the president's power is '%s'", m.pendingPower)
+	}
+	return nil
+}
+
+func (m *moose) investigate(u string, target int) error {
+	if err := m.requirePower(u, powerInvestigate); err != nil {
+		return err
+	}
+	p := m.players[target]
+	if p.investigated {
+		return fmt.Errorf("player '%s' has already been investigated", p.id)
 	}
+	p.investigated = true
+	president := m.players[m.president]
+	if president.investigations == nil {
+		president.investigations = map[string]string{}
+	}
+	president.investigations[p.id] = p.team()
+	m.advancePresidency()
+	return nil
+}
+
+func (m *moose) specialElection(u string, target int) error {
+	if err := m.requirePower(u, powerSpecialElection); err != nil {
+		return err
+	}
+	m.resumeAfter = m.president
+	m.president = target
+	m.beginNomination()
+	return nil
+}
+
+func (m *moose) execute(u string, target int) error {
+	if err := m.requirePower(u, powerExecution); err != nil {
+		return err
+	}
+	p := m.players[target]
+	p.alive = false
+	if p.role == roleMoose {
+		m.endGame(roleLiberal, "the moose was executed")
+		return nil
+	}
+	m.advancePresidency()
+	return nil
+}
+
+// enact places a policy on its track and reports whether that ended the game. Any earlier policy
+// peek is stale once the deck has moved on.
+func (m *moose) enact(p string, chaos bool) bool {
+	m.lastPolicy = p
+	m.lastChaos = chaos
+	for _, pl := range m.players {
+		pl.peek = nil
+	}
+	if p == policyLiberal {
+		m.liberalTrack++
+	} else {
+		m.fascistTrack++
+	}
+	m.reshuffleIfNeeded()
+	switch {
+	case m.liberalTrack >= mooseLiberalTrack:
+		m.endGame(roleLiberal, "five liberal policies were enacted")
+	case m.fascistTrack >= mooseFascistTrack:
+		m.endGame(roleFascist, "six fascist policies were enacted")
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *moose) draw(n int) []string {
+	m.reshuffleIfNeeded()
+	h := append([]string{}, m.drawPile[:n]...)
+	m.drawPile = m.drawPile[n:]
+	return h
+}
+
+// reshuffleIfNeeded folds the discard pile back into the deck when fewer than three policies remain.
+func (m *moose) reshuffleIfNeeded() {
+	if len(m.drawPile) >= 3 {
+		return
+	}
+	m.drawPile = append(m.drawPile, m.discardPile...)
+	m.discardPile = nil
+	m.rng.Shuffle(len(m.drawPile), func(i, j int) { m.drawPile[i], m.drawPile[j] = m.drawPile[j], m.drawPile[i] })
+}
+
+func (m *moose) endGame(winner, reason string) {
+	m.phase = phaseGameOver
+	m.winner = winner
+	m.winReason = reason
+	m.pendingPower = powerNone
+	m.votes = nil
+	m.hand = nil
+}
+
+func payloadString(p map[string]interface{}, k string) (string, error) {
+	if s, ok := p[k].(string); ok && s != "" {
+		return s, nil
+	}
+	return "", fmt.Errorf("'%s' must be a non-empty string", k)
+}
+
+func payloadBool(p map[string]interface{}, k string) (bool, error) {
+	if b, ok := p[k].(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("'%s' must be a boolean", k)
+}
+
+func payloadInt(p map[string]interface{}, k string) (int, error) {
+	if f, ok := p[k].(float64); ok && f == float64(int(f)) {
+		return int(f), nil
+	}
+	return 0, fmt.Errorf("'%s' must be an integer", k)
+}
+
+// NewMoose sets up an empty table. Its id comes from env, everything random about the game from env's
+// seed and all of its timers run on env's clock, so the same env & inputs replay a game move for move.
+func NewMoose(name string, options map[string]interface{}, env Env) *moose {
+	id := env.ID
+	if env.Clock == nil {
+		env.Clock = SystemClock
+	}
+	pregame := NewPregame(mooseGameType, options)
+	eventLog := NewEventLog(env.Clock)
 	g := &moose{
-		name:       name,
-		id:         id,
-		gameEvents: make(chan []byte, 50),
+		name:  name,
+		id:    id,
+		loop:  NewLoop(50, eventLog),
+		log:   eventLog,
+		clock: env.Clock,
+		metadata: gsinterfaces.GameMetadata{
+			ID:      id,
+			Name:    name,
+			Type:    mooseType,
+			Options: pregame.Options(),
+			Seed:    env.Seed,
+			Created: env.Clock.Now(),
+		},
+		pregame:        pregame,
+		notices:        map[string]interface{}{},
+		rng:            rand.New(rand.NewSource(env.Seed)),
+		phase:          phaseLobby,
+		president:      -1,
+		resumeAfter:    -1,
+		nominee:        -1,
+		chancellor:     -1,
+		lastPresident:  -1,
+		lastChancellor: -1,
 	}
-	go g.StartGameLoop()
+	g.timers = NewTimers(g.loop, g.clock)
+	g.timers.Set(timerGameTimeout, mooseGameTimeout, 0)
+	g.summarize()
 	return g
 }
+
+// restoreMoose sets the table up again under its old id and replays everything that happened at it.
+// Timers start over from the moment it's restored.
+func restoreMoose(b []byte, clock Clock) (gsinterfaces.Game, error) {
+	sn, err := decodeSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	md := sn.Metadata
+	// Options come back from JSON with every number a float64
+	options, err := mooseGameType.ValidateOptions(md.Options)
+	if err != nil {
+		return nil, err
+	}
+	m := NewMoose(md.Name, options, Env{Clock: clock, Seed: md.Seed})
+	m.profilemtx.Lock()
+	m.id = md.ID
+	m.metadata = md
+	m.profilemtx.Unlock()
+	if err := replayInputs(m.loop, m.process, sn.Inputs); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,427 @@
+package games
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+var testStart = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTable sets up a table on a clock that only moves when the test says so, with n players seated
+func newTable(t *testing.T, n int, options map[string]interface{}) (*moose, []string) {
+	t.Helper()
+	options, err := mooseGameType.ValidateOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMoose("test", options, Env{ID: "table", Clock: NewManualClock(testStart), Seed: 1})
+	ids := []string{}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("p%d", i)
+		if err := m.process(gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: id}); err != nil {
+			t.Fatalf("join %s: %s", id, err)
+		}
+		ids = append(ids, id)
+	}
+	return m, ids
+}
+
+// startedTable is newTable with everyone ready & the game started by the host
+func startedTable(t *testing.T, n int) *moose {
+	t.Helper()
+	m, ids := newTable(t, n, nil)
+	for _, id := range ids {
+		mustAct(t, m, id, map[string]interface{}{"type": "TOGGLE_READY"})
+	}
+	mustAct(t, m, ids[0], map[string]interface{}{"type": "START_GAME"})
+	return m
+}
+
+func act(m *moose, u string, p map[string]interface{}) error {
+	return m.process(gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: u, Payload: p})
+}
+
+func mustAct(t *testing.T, m *moose, u string, p map[string]interface{}) {
+	t.Helper()
+	if err := act(m, u, p); err != nil {
+		t.Fatalf("%s %v: %s", u, p, err)
+	}
+}
+
+// nominee picks the first seat the president may nominate
+func nominee(m *moose) string {
+	for i, p := range m.players {
+		if p.alive && i != m.president && i != m.lastChancellor && (i != m.lastPresident || m.alivePlayers() <= mooseMinPlayers) {
+			return p.id
+		}
+	}
+	return ""
+}
+
+func voteAll(t *testing.T, m *moose, ja bool) {
+	t.Helper()
+	for _, p := range m.players {
+		if p.alive {
+			mustAct(t, m, p.id, map[string]interface{}{"type": "VOTE", "vote": ja})
+		}
+	}
+}
+
+func seatOfRole(m *moose, role string) int {
+	for i, p := range m.players {
+		if p.role == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestMooseDealsRoles(t *testing.T) {
+	for n := mooseMinPlayers; n <= mooseMaxPlayers; n++ {
+		m := startedTable(t, n)
+		roles := map[string]int{}
+		for _, p := range m.players {
+			roles[p.role]++
+		}
+		if roles[roleMoose] != 1 || roles[roleFascist] != mooseFascists[n] || roles[roleLiberal] != n-1-mooseFascists[n] {
+			t.Errorf("%d players were dealt %v", n, roles)
+		}
+		if m.phase != phaseNomination {
+			t.Errorf("%d players start in phase %s", n, m.phase)
+		}
+		if len(m.drawPile) != mooseLiberalPolicyCount+mooseFascistPolicyCount {
+			t.Errorf("%d players start with %d policies", n, len(m.drawPile))
+		}
+	}
+}
+
+func TestMooseStartNeedsEveryoneReady(t *testing.T) {
+	m, ids := newTable(t, mooseMinPlayers, nil)
+	mustAct(t, m, ids[0], map[string]interface{}{"type": "TOGGLE_READY"})
+	if err := act(m, ids[0], map[string]interface{}{"type": "START_GAME"}); err == nil {
+		t.Fatal("started with players that aren't ready")
+	}
+	if m.phase != phaseLobby {
+		t.Fatalf("phase is %s", m.phase)
+	}
+}
+
+func TestMooseLegislativeSession(t *testing.T) {
+	m := startedTable(t, 5)
+	president := m.seatID(m.president)
+	chancellor := nominee(m)
+	other := m.seatID((m.president + 1) % 5)
+	if other == chancellor {
+		other = m.seatID((m.president + 2) % 5)
+	}
+
+	if err := act(m, other, map[string]interface{}{"type": "NOMINATE", "player": chancellor}); err == nil {
+		t.Error("a player other than the president nominated")
+	}
+	if err := act(m, president, map[string]interface{}{"type": "NOMINATE", "player": president}); err == nil {
+		t.Error("the president nominated themselves")
+	}
+	mustAct(t, m, president, map[string]interface{}{"type": "NOMINATE", "player": chancellor})
+	mustAct(t, m, president, map[string]interface{}{"type": "VOTE", "vote": true})
+	if err := act(m, president, map[string]interface{}{"type": "VOTE", "vote": true}); err == nil {
+		t.Error("voted twice")
+	}
+	for _, p := range m.players {
+		if p.id != president {
+			mustAct(t, m, p.id, map[string]interface{}{"type": "VOTE", "vote": true})
+		}
+	}
+	if m.phase != phaseLegislativePresident || len(m.hand) != 3 || len(m.drawPile) != 14 {
+		t.Fatalf("after the election phase is %s with %d in hand & %d to draw", m.phase, len(m.hand), len(m.drawPile))
+	}
+
+	if err := act(m, chancellor, map[string]interface{}{"type": "DISCARD_POLICY", "index": float64(0)}); err == nil {
+		t.Error("the chancellor discarded for the president")
+	}
+	if err := act(m, president, map[string]interface{}{"type": "DISCARD_POLICY", "index": float64(3)}); err == nil {
+		t.Error("discarded a policy that isn't in hand")
+	}
+	mustAct(t, m, president, map[string]interface{}{"type": "DISCARD_POLICY", "index": float64(0)})
+	if m.phase != phaseLegislativeChancellor || len(m.hand) != 2 {
+		t.Fatalf("after the discard phase is %s with %d in hand", m.phase, len(m.hand))
+	}
+	enacted := m.hand[1]
+	mustAct(t, m, chancellor, map[string]interface{}{"type": "ENACT_POLICY", "index": float64(1)})
+	if m.liberalTrack+m.fascistTrack != 1 || m.lastPolicy != enacted || len(m.discardPile) != 2 {
+		t.Fatalf("enacted %s, tracks are %d/%d with %d discarded", enacted, m.liberalTrack, m.fascistTrack, len(m.discardPile))
+	}
+
+	// The first fascist policy grants no power at five players, so the presidency moves on either way
+	if m.phase != phaseNomination || m.seatID(m.lastPresident) != president || m.seatID(m.lastChancellor) != chancellor {
+		t.Fatalf("phase %s, last government %s & %s", m.phase, m.seatID(m.lastPresident), m.seatID(m.lastChancellor))
+	}
+	if err := act(m, m.seatID(m.president), map[string]interface{}{"type": "NOMINATE", "player": chancellor}); err == nil {
+		t.Error("nominated the term limited chancellor")
+	}
+}
+
+func TestMooseChaosAfterThreeFailedElections(t *testing.T) {
+	m := startedTable(t, 5)
+	for i := 0; i < mooseElectionTracker; i++ {
+		if m.electionTracker != i {
+			t.Fatalf("election tracker is %d after %d failed elections", m.electionTracker, i)
+		}
+		mustAct(t, m, m.seatID(m.president), map[string]interface{}{"type": "NOMINATE", "player": nominee(m)})
+		voteAll(t, m, false)
+	}
+	if m.electionTracker != 0 || !m.lastChaos || m.liberalTrack+m.fascistTrack != 1 {
+		t.Fatalf("tracker %d, chaos %t, tracks %d/%d", m.electionTracker, m.lastChaos, m.liberalTrack, m.fascistTrack)
+	}
+	if m.lastPresident != -1 || m.lastChancellor != -1 {
+		t.Fatal("term limits weren't lifted by the chaos")
+	}
+}
+
+func TestMooseElectingTheMoose(t *testing.T) {
+	m := startedTable(t, 5)
+	mooseSeat := seatOfRole(m, roleMoose)
+	m.president = (mooseSeat + 1) % 5
+	m.fascistTrack = mooseMooseElectableAt
+	mustAct(t, m, m.seatID(m.president), map[string]interface{}{"type": "NOMINATE", "player": m.seatID(mooseSeat)})
+	voteAll(t, m, true)
+	if m.phase != phaseGameOver || m.winner != roleFascist {
+		t.Fatalf("phase %s, winner %s", m.phase, m.winner)
+	}
+}
+
+func TestMooseExecution(t *testing.T) {
+	m := startedTable(t, 5)
+	mooseSeat := seatOfRole(m, roleMoose)
+	m.president = (mooseSeat + 1) % 5
+	liberal := (mooseSeat + 2) % 5
+	if m.players[liberal].role != roleLiberal {
+		liberal = (mooseSeat + 3) % 5
+	}
+	m.phase = phaseExecutiveAction
+	m.pendingPower = powerExecution
+	president := m.seatID(m.president)
+	if err := act(m, president, map[string]interface{}{"type": "INVESTIGATE", "player": m.seatID(liberal)}); err == nil {
+		t.Error("used a power the president wasn't granted")
+	}
+	mustAct(t, m, president, map[string]interface{}{"type": "EXECUTE", "player": m.seatID(liberal)})
+	if m.players[liberal].alive || m.phase != phaseNomination {
+		t.Fatalf("executed player alive %t, phase %s", m.players[liberal].alive, m.phase)
+	}
+
+	m.president = (mooseSeat + 1) % 5
+	m.phase = phaseExecutiveAction
+	m.pendingPower = powerExecution
+	mustAct(t, m, m.seatID(m.president), map[string]interface{}{"type": "EXECUTE", "player": m.seatID(mooseSeat)})
+	if m.phase != phaseGameOver || m.winner != roleLiberal {
+		t.Fatalf("phase %s, winner %s", m.phase, m.winner)
+	}
+}
+
+func TestMooseVeto(t *testing.T) {
+	m := startedTable(t, 5)
+	m.fascistTrack = mooseVetoUnlockedAt
+	// Electing the moose this late would end the game
+	m.players[m.president], m.players[seatOfRole(m, roleMoose)] = m.players[seatOfRole(m, roleMoose)], m.players[m.president]
+	president := m.seatID(m.president)
+	chancellor := nominee(m)
+	mustAct(t, m, president, map[string]interface{}{"type": "NOMINATE", "player": chancellor})
+	voteAll(t, m, true)
+	mustAct(t, m, president, map[string]interface{}{"type": "DISCARD_POLICY", "index": float64(0)})
+	if err := act(m, president, map[string]interface{}{"type": "PROPOSE_VETO"}); err == nil {
+		t.Error("the president proposed a veto")
+	}
+	mustAct(t, m, chancellor, map[string]interface{}{"type": "PROPOSE_VETO"})
+	if err := act(m, chancellor, map[string]interface{}{"type": "ENACT_POLICY", "index": float64(0)}); err == nil {
+		t.Error("enacted a policy while the veto was pending")
+	}
+	discarded := len(m.discardPile)
+	mustAct(t, m, president, map[string]interface{}{"type": "RESPOND_VETO", "accept": true})
+	if m.phase != phaseNomination || m.electionTracker != 1 || len(m.discardPile) != discarded+2 {
+		t.Fatalf("phase %s, tracker %d, %d discarded", m.phase, m.electionTracker, len(m.discardPile))
+	}
+}
+
+func TestMooseElectionExpiresWithPartialVotes(t *testing.T) {
+	m, ids := newTable(t, 5, map[string]interface{}{"turn_seconds": 30})
+	for _, id := range ids {
+		mustAct(t, m, id, map[string]interface{}{"type": "TOGGLE_READY"})
+	}
+	mustAct(t, m, ids[0], map[string]interface{}{"type": "START_GAME"})
+	mustAct(t, m, m.seatID(m.president), map[string]interface{}{"type": "NOMINATE", "player": nominee(m)})
+	// The first two seats run out of time, everyone after them votes ja
+	for _, p := range m.players[2:] {
+		mustAct(t, m, p.id, map[string]interface{}{"type": "VOTE", "vote": true})
+	}
+
+	published := 0
+	m.SetFromGameHandler(func(_ string, o *gsinterfaces.GameOutput) {
+		if !o.Transient {
+			published++
+		}
+	})
+	go m.Run()
+	defer m.Shutdown()
+	m.clock.(*ManualClock).Advance(30 * time.Second)
+	// Handled after the timer's input, so the expired turn has been dealt with by the time it returns
+	m.loop.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: ids[0], Payload: map[string]interface{}{"type": "NOPE"}})
+
+	if m.phase != phaseLegislativePresident || m.electionTracker != 0 {
+		t.Fatalf("election wasn't settled 3 to 2, phase %s & tracker %d", m.phase, m.electionTracker)
+	}
+	if published != 1 {
+		t.Fatalf("the expired turn published %d states", published)
+	}
+}
+
+func TestMooseIsDeterministic(t *testing.T) {
+	play := func() *moose {
+		m, ids := newTable(t, 7, nil)
+		for _, id := range ids {
+			mustAct(t, m, id, map[string]interface{}{"type": "TOGGLE_READY"})
+		}
+		mustAct(t, m, ids[0], map[string]interface{}{"type": "START_GAME"})
+		mustAct(t, m, m.seatID(m.president), map[string]interface{}{"type": "NOMINATE", "player": nominee(m)})
+		// Everyone but the last seat votes, so who has voted is part of the state
+		for _, p := range m.players[:len(m.players)-1] {
+			mustAct(t, m, p.id, map[string]interface{}{"type": "VOTE", "vote": true})
+		}
+		return m
+	}
+	a, b := play(), play()
+	if a.ID() != b.ID() || a.Name() != b.Name() || !reflect.DeepEqual(a.Metadata(), b.Metadata()) {
+		t.Fatalf("got %+v & %+v", a.Metadata(), b.Metadata())
+	}
+	if !reflect.DeepEqual(a.Log(), b.Log()) {
+		t.Fatal("the same env & inputs played out differently")
+	}
+}
+
+func TestMooseRejectsMalformedActions(t *testing.T) {
+	m := startedTable(t, 5)
+	president := m.seatID(m.president)
+	err := act(m, president, map[string]interface{}{})
+	if ge, ok := err.(*gameError); !ok || ge.Type != "INVALID_EVENT" {
+		t.Errorf("missing type: %v", err)
+	}
+	err = act(m, president, map[string]interface{}{"type": "DANCE"})
+	if ge, ok := err.(*gameError); !ok || ge.Type != "UNKNOWN_EVENT" {
+		t.Errorf("unknown type: %v", err)
+	}
+	err = act(m, president, map[string]interface{}{"type": "DISCARD_POLICY", "index": "0"})
+	if ge, ok := err.(*gameError); !ok || ge.Type != "INVALID_ACTION" {
+		t.Errorf("string index: %v", err)
+	}
+	if err := act(m, "stranger", map[string]interface{}{"type": "VOTE", "vote": true}); err == nil {
+		t.Error("a player who isn't seated voted")
+	}
+}
+
+func TestMoosePowers(t *testing.T) {
+	cases := []struct {
+		players, n int
+		power      string
+	}{
+		{5, 1, powerNone},
+		{5, 3, powerPolicyPeek},
+		{6, 4, powerExecution},
+		{7, 2, powerInvestigate},
+		{8, 3, powerSpecialElection},
+		{9, 1, powerInvestigate},
+		{10, 6, powerNone},
+		{10, 7, powerNone},
+	}
+	for _, c := range cases {
+		if p := moosePowers(c.players, c.n); p != c.power {
+			t.Errorf("fascist policy %d at %d players grants '%s', want '%s'", c.n, c.players, p, c.power)
+		}
+	}
+}
+
+func TestMooseViewsKeepRolesPrivate(t *testing.T) {
+	m := startedTable(t, 7)
+	o := m.stateOutput()
+	for _, p := range o.Public.(*mooseState).Players {
+		if p.Role != "" {
+			t.Fatalf("the public state gives away the role of %s", p.ID)
+		}
+	}
+	if len(o.Audience) != 7 || len(o.Private) != 7 {
+		t.Fatalf("%d in the audience with %d private views", len(o.Audience), len(o.Private))
+	}
+	for _, p := range m.players {
+		v := o.Private[p.id].(*mooseView)
+		if v.Role != p.role {
+			t.Errorf("%s sees their role as %s, not %s", p.id, v.Role, p.role)
+		}
+		switch p.role {
+		case roleFascist:
+			if len(v.Teammates) != mooseFascists[7] {
+				t.Errorf("fascist %s knows of %d teammates", p.id, len(v.Teammates))
+			}
+		default:
+			// The moose only learns who the fascists are at small tables
+			if len(v.Teammates) != 0 {
+				t.Errorf("%s %s knows of %d teammates", p.role, p.id, len(v.Teammates))
+			}
+		}
+	}
+
+	president := m.seatID(m.president)
+	mustAct(t, m, president, map[string]interface{}{"type": "NOMINATE", "player": nominee(m)})
+	voteAll(t, m, true)
+	if m.phase == phaseLegislativePresident {
+		for id, v := range m.stateOutput().Private {
+			if hand := len(v.(*mooseView).Hand); (id == president) != (hand == 3) {
+				t.Errorf("%s sees %d policies in hand", id, hand)
+			}
+		}
+	}
+
+	m.endGame(roleLiberal, "test")
+	for _, p := range m.stateOutput().Public.(*mooseState).Players {
+		if p.Role == "" {
+			t.Fatalf("the role of %s is still hidden once the game is over", p.ID)
+		}
+	}
+}
+
+func TestMooseSmallTableMooseKnowsFascists(t *testing.T) {
+	m := startedTable(t, 5)
+	p := m.players[seatOfRole(m, roleMoose)]
+	if v := m.viewFor(p); len(v.Teammates) != 1 {
+		t.Fatalf("the moose knows of %d teammates at five players", len(v.Teammates))
+	}
+}
+
+func TestMooseLeavingAFinishedGameKeepsTheSeating(t *testing.T) {
+	m := startedTable(t, 5)
+	president := m.seatID(m.president)
+	m.endGame(roleLiberal, "test")
+	leaver := m.players[0].id
+	if leaver == president {
+		leaver = m.players[1].id
+	}
+	if err := m.process(gsinterfaces.Input{Kind: gsinterfaces.InputLeave, User: leaver}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.process(gsinterfaces.Input{Kind: gsinterfaces.InputLeave, User: leaver}); err == nil {
+		t.Error("left a finished game twice")
+	}
+	if len(m.players) != 5 || m.seatID(m.president) != president {
+		t.Fatalf("%d seats left with %s as president", len(m.players), m.seatID(m.president))
+	}
+	for _, id := range append(m.Players(), m.stateOutput().Audience...) {
+		if id == leaver {
+			t.Fatalf("%s is still a player or in the audience", leaver)
+		}
+	}
+	for _, p := range m.stateOutput().Public.(*mooseState).Players {
+		if p.Role == "" {
+			t.Fatalf("the role of %s is no longer revealed", p.ID)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Pregame is the seating, ready check and host controls a game runs through before it starts.
+// It does no locking of its own, the game embedding it guards it along with the rest of its state.
+type Pregame struct {
+	gameType *Type
+	host     string
+	seats    []string
+	ready    map[string]bool
+	options  map[string]interface{}
+}
+
+// NewPregame sets up an empty table for a game type. Options are expected to have been validated,
+// when nil every option takes its default.
+func NewPregame(t *Type, options map[string]interface{}) *Pregame {
+	if options == nil {
+		options, _ = t.ValidateOptions(nil)
+	}
+	return &Pregame{
+		gameType: t,
+		ready:    map[string]bool{},
+		options:  options,
+	}
+}
+
+func (p *Pregame) Host() string {
+	return p.host
+}
+
+func (p *Pregame) Seats() []string {
+	return append([]string{}, p.seats...)
+}
+
+func (p *Pregame) IsSeated(u string) bool {
+	return p.seatOf(u) >= 0
+}
+
+func (p *Pregame) IsReady(u string) bool {
+	return p.ready[u]
+}
+
+func (p *Pregame) Options() map[string]interface{} {
+	o := make(map[string]interface{}, len(p.options))
+	for k, v := range p.options {
+		o[k] = v
+	}
+	return o
+}
+
+// Capacity is the number of seats at the table. A game declaring a 'max_players' option can use it
+// to shrink the table below the maximum its type allows.
+func (p *Pregame) Capacity() int {
+	if n, ok := p.options["max_players"].(int); ok {
+		return n
+	}
+	return p.gameType.MaxPlayers
+}
+
+// Join seats a player, handing them the host role if the table has none.
+func (p *Pregame) Join(u string) error {
+	if p.IsSeated(u) {
+		return errors.New("already seated")
+	}
+	if len(p.seats) >= p.Capacity() {
+		return errors.New("table is full")
+	}
+	p.seats = append(p.seats, u)
+	if p.host == "" {
+		p.host = u
+	}
+	return nil
+}
+
+// Leave frees up a seat. When the host leaves the next player in seat order takes over.
+func (p *Pregame) Leave(u string) error {
+	i := p.seatOf(u)
+	if i < 0 {
+		return errors.New("not seated")
+	}
+	p.seats = append(p.seats[:i], p.seats[i+1:]...)
+	delete(p.ready, u)
+	if p.host == u {
+		p.host = ""
+		if len(p.seats) > 0 {
+			p.host = p.seats[0]
+		}
+	}
+	return nil
+}
+
+func (p *Pregame) ToggleReady(u string) error {
+	if !p.IsSeated(u) {
+		return errors.New("not seated")
+	}
+	p.ready[u] = !p.ready[u]
+	return nil
+}
+
+func (p *Pregame) Kick(by, target string) error {
+	if err := p.requireHost(by); err != nil {
+		return err
+	}
+	if by == target {
+		return errors.New("the host cannot kick themselves")
+	}
+	return p.Leave(target)
+}
+
+func (p *Pregame) TransferHost(by, target string) error {
+	if err := p.requireHost(by); err != nil {
+		return err
+	}
+	if !p.IsSeated(target) {
+		return fmt.Errorf("player '%s' is not seated at this table", target)
+	}
+	p.host = target
+	return nil
+}
+
+// SetOptions merges changes into the current options. Everyone has to ready up again afterwards
+// since they agreed to play under the old settings.
+func (p *Pregame) SetOptions(by string, changes map[string]interface{}) error {
+	if err := p.requireHost(by); err != nil {
+		return err
+	}
+	merged := p.Options()
+	for k, v := range changes {
+		merged[k] = v
+	}
+	opts, err := p.gameType.ValidateOptions(merged)
+	if err != nil {
+		return err
+	}
+	old := p.options
+	p.options = opts
+	if len(p.seats) > p.Capacity() {
+		p.options = old
+		return fmt.Errorf("%d players are already seated", len(p.seats))
+	}
+	p.ready = map[string]bool{}
+	return nil
+}
+
+// CheckStart reports whether the host may start the game: enough players are seated and all of them are ready.
+func (p *Pregame) CheckStart(by string) error {
+	if err := p.requireHost(by); err != nil {
+		return err
+	}
+	if len(p.seats) < p.gameType.MinPlayers {
+		return fmt.Errorf("need at least %d players, have %d", p.gameType.MinPlayers, len(p.seats))
+	}
+	for _, u := range p.seats {
+		if !p.ready[u] {
+			return fmt.Errorf("player '%s' is not ready", u)
+		}
+	}
+	return nil
+}
+
+func (p *Pregame) requireHost(u string) error {
+	if u != p.host {
+		return errors.New("only the host can do that")
+	}
+	return nil
+}
+
+func (p *Pregame) seatOf(u string) int {
+	for i, s := range p.seats {
+		if s == u {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package games
+
+import "testing"
+
+func newTestPregame(t *testing.T, seats ...string) *Pregame {
+	t.Helper()
+	p := NewPregame(testType, nil)
+	for _, u := range seats {
+		if err := p.Join(u); err != nil {
+			t.Fatalf("join %s: %s", u, err)
+		}
+	}
+	return p
+}
+
+func TestPregameSeating(t *testing.T) {
+	p := newTestPregame(t, "a", "b", "c", "d")
+	if p.Host() != "a" {
+		t.Fatalf("host is %s", p.Host())
+	}
+	if err := p.Join("e"); err == nil {
+		t.Error("joined a full table")
+	}
+	if err := p.Join("b"); err == nil {
+		t.Error("joined twice")
+	}
+	if err := p.Leave("a"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Host() != "b" {
+		t.Fatalf("host is %s after the host left", p.Host())
+	}
+	if err := p.Leave("a"); err == nil {
+		t.Error("left twice")
+	}
+	for _, u := range []string{"b", "c", "d"} {
+		p.Leave(u)
+	}
+	if p.Host() != "" || len(p.Seats()) != 0 {
+		t.Fatalf("empty table has host '%s' & seats %v", p.Host(), p.Seats())
+	}
+}
+
+func TestPregameHostControls(t *testing.T) {
+	p := newTestPregame(t, "a", "b", "c")
+	if err := p.Kick("b", "c"); err == nil {
+		t.Error("a player other than the host kicked")
+	}
+	if err := p.Kick("a", "a"); err == nil {
+		t.Error("the host kicked themselves")
+	}
+	if err := p.Kick("a", "c"); err != nil || p.IsSeated("c") {
+		t.Fatalf("kick: %v", err)
+	}
+	if err := p.TransferHost("a", "c"); err == nil {
+		t.Error("handed the host to a player who isn't seated")
+	}
+	if err := p.TransferHost("a", "b"); err != nil || p.Host() != "b" {
+		t.Fatalf("transfer: %v, host %s", err, p.Host())
+	}
+	if err := p.SetOptions("a", map[string]interface{}{"mode": "ranked"}); err == nil {
+		t.Error("the old host changed the options")
+	}
+}
+
+func TestPregameOptionsResetReady(t *testing.T) {
+	p := newTestPregame(t, "a", "b", "c")
+	p.ToggleReady("a")
+	p.ToggleReady("b")
+	if err := p.SetOptions("a", map[string]interface{}{"mode": "ranked"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.IsReady("a") || p.IsReady("b") {
+		t.Fatal("players are still ready after the options changed")
+	}
+	if p.Options()["mode"] != "ranked" || p.Options()["max_players"] != 4 {
+		t.Fatalf("options %v", p.Options())
+	}
+	if err := p.SetOptions("a", map[string]interface{}{"mode": "hardcore"}); err == nil {
+		t.Error("set an invalid option")
+	}
+	p.ToggleReady("a")
+	if err := p.SetOptions("a", map[string]interface{}{"max_players": float64(2)}); err == nil {
+		t.Error("shrunk the table below the players seated")
+	}
+	if !p.IsReady("a") || p.Options()["max_players"] != 4 {
+		t.Fatal("a rejected change still went through")
+	}
+}
+
+func TestPregameCapacity(t *testing.T) {
+	p := NewPregame(testType, map[string]interface{}{"max_players": 2})
+	p.Join("a")
+	p.Join("b")
+	if p.Capacity() != 2 {
+		t.Fatalf("capacity %d", p.Capacity())
+	}
+	if err := p.Join("c"); err == nil {
+		t.Fatal("joined past the table's seats option")
+	}
+}
+
+func TestPregameCheckStart(t *testing.T) {
+	p := NewPregame(mooseGameType, nil)
+	for _, u := range []string{"a", "b", "c", "d"} {
+		p.Join(u)
+		p.ToggleReady(u)
+	}
+	if err := p.CheckStart("a"); err == nil {
+		t.Error("started without enough players")
+	}
+	p.Join("e")
+	if err := p.CheckStart("a"); err == nil {
+		t.Error("started with a player who isn't ready")
+	}
+	p.ToggleReady("e")
+	if err := p.CheckStart("b"); err == nil {
+		t.Error("a player other than the host started")
+	}
+	if err := p.CheckStart("a"); err != nil {
+		t.Fatal(err)
+	}
+	p.ToggleReady("e")
+	if err := p.CheckStart("a"); err == nil {
+		t.Error("toggling ready twice left the player ready")
+	}
+}
@@ -0,0 +1,195 @@
+package games
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	namesgenerator "github.com/moby/moby/pkg/namesgenerator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Supported option value types
+const (
+	OptionString = "string"
+	OptionInt    = "int"
+	OptionBool   = "bool"
+)
+
+// Option describes a single setting a game accepts when it's created.
+type Option struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Min         int         `json:"min,omitempty"`
+	Max         int         `json:"max,omitempty"`
+	Choices     []string    `json:"choices,omitempty"`
+}
+
+// Type is a registered kind of game and the factory used to build new instances of it.
+type Type struct {
+	Name        string   `json:"type"`
+	DisplayName string   `json:"display_name"`
+	MinPlayers  int      `json:"min_players"`
+	MaxPlayers  int      `json:"max_players"`
+	Options     []Option `json:"options"`
+	// New receives options that have already been validated with every default filled in
+	New func(name string, options map[string]interface{}, env Env) (gsinterfaces.Game, error) `json:"-"`
+	// Restore brings a game back from its Snapshot, nil if the type can't be restored
+	Restore func(snapshot []byte, clock Clock) (gsinterfaces.Game, error) `json:"-"`
+	// Events are top-level events the game type handles itself, each payload declared with event.Register
+	Events map[string]gsinterfaces.EventHandler `json:"-"`
+}
+
+var (
+	registrymtx sync.RWMutex
+	registry    = map[string]*Type{}
+)
+
+// Register makes a game type available to the server. It panics if the same name is registered twice.
+func Register(t *Type) {
+	registrymtx.Lock()
+	defer registrymtx.Unlock()
+	if t == nil || t.New == nil {
+		panic("games: Register of nil game type or factory")
+	}
+	if _, ok := registry[t.Name]; ok {
+		panic(fmt.Sprintf("games: Register called twice for '%s'", t.Name))
+	}
+	registry[t.Name] = t
+}
+
+// Lookup finds a registered game type by name.
+func Lookup(name string) (*Type, bool) {
+	registrymtx.RLock()
+	defer registrymtx.RUnlock()
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Types lists every registered game type ordered by name.
+func Types() []*Type {
+	registrymtx.RLock()
+	ts := make([]*Type, 0, len(registry))
+	for _, t := range registry {
+		ts = append(ts, t)
+	}
+	registrymtx.RUnlock()
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+	return ts
+}
+
+// Env is everything a game takes from the world around it. Given the same Env, options & inputs a game
+// plays out exactly the same way again.
+type Env struct {
+	// ID the game goes by, Create picks a fresh one if it's empty
+	ID    string
+	Clock Clock
+	Seed  int64
+}
+
+// NewEnv runs a game on the wall clock with a fresh seed
+func NewEnv() Env {
+	return Env{
+		Clock: SystemClock,
+		Seed:  time.Now().UnixNano(),
+	}
+}
+
+// Create validates the requested options against the schema and constructs a new game. A game without
+// a name gets a random one.
+func (t *Type) Create(name string, options map[string]interface{}, env Env) (gsinterfaces.Game, error) {
+	opts, err := t.ValidateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = randomName()
+	}
+	if env.ID == "" {
+		env.ID = uuid.Must(uuid.NewV4()).String()
+	}
+	if env.Clock == nil {
+		env.Clock = SystemClock
+	}
+	return t.New(name, opts, env)
+}
+
+// randomName makes up a name like "Admiring Turing"
+func randomName() string {
+	genName := strings.Split(namesgenerator.GetRandomName(0), "_")
+	return fmt.Sprintf("%s %s", strings.Title(genName[0]), strings.Title(genName[1]))
+}
+
+// ValidateOptions checks options against the schema, rejecting unknown keys and filling in defaults.
+func (t *Type) ValidateOptions(options map[string]interface{}) (map[string]interface{}, error) {
+	known := map[string]bool{}
+	opts := map[string]interface{}{}
+	for _, o := range t.Options {
+		known[o.Name] = true
+		v, ok := options[o.Name]
+		if !ok {
+			opts[o.Name] = o.Default
+			continue
+		}
+		cv, err := o.validate(v)
+		if err != nil {
+			return nil, err
+		}
+		opts[o.Name] = cv
+	}
+	for k := range options {
+		if !known[k] {
+			return nil, fmt.Errorf("unknown option '%s' for game type '%s'", k, t.Name)
+		}
+	}
+	return opts, nil
+}
+
+func (o *Option) validate(v interface{}) (interface{}, error) {
+	switch o.Type {
+	case OptionString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("option '%s' must be a string", o.Name)
+		}
+		if len(o.Choices) == 0 {
+			return s, nil
+		}
+		for _, c := range o.Choices {
+			if c == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("option '%s' must be one of %v", o.Name, o.Choices)
+	case OptionInt:
+		// Numbers come off the wire as float64
+		var i int
+		switch n := v.(type) {
+		case float64:
+			if n != float64(int(n)) {
+				return nil, fmt.Errorf("option '%s' must be an integer", o.Name)
+			}
+			i = int(n)
+		case int:
+			i = n
+		default:
+			return nil, fmt.Errorf("option '%s' must be an integer", o.Name)
+		}
+		if i < o.Min || (o.Max != 0 && i > o.Max) {
+			return nil, fmt.Errorf("option '%s' must be between %d and %d", o.Name, o.Min, o.Max)
+		}
+		return i, nil
+	case OptionBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("option '%s' must be a boolean", o.Name)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("option '%s' has unsupported type '%s'", o.Name, o.Type)
+}
@@ -0,0 +1,119 @@
+package games
+
+import (
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+var testType = &Type{
+	Name:       "TEST_OPTIONS",
+	MinPlayers: 1,
+	MaxPlayers: 4,
+	Options: []Option{
+		{Name: "max_players", Type: OptionInt, Default: 4, Min: 1, Max: 4},
+		{Name: "mode", Type: OptionString, Default: "casual", Choices: []string{"casual", "ranked"}},
+		{Name: "title", Type: OptionString, Default: ""},
+		{Name: "timer", Type: OptionBool, Default: false},
+	},
+	New: func(name string, options map[string]interface{}, env Env) (gsinterfaces.Game, error) {
+		return nil, nil
+	},
+}
+
+func TestValidateOptionsDefaults(t *testing.T) {
+	opts, err := testType.ValidateOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts["max_players"] != 4 || opts["mode"] != "casual" || opts["title"] != "" || opts["timer"] != false {
+		t.Fatalf("defaults are %v", opts)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	cases := []struct {
+		options map[string]interface{}
+		ok      bool
+	}{
+		// Numbers arrive from JSON as float64
+		{map[string]interface{}{"max_players": float64(2)}, true},
+		{map[string]interface{}{"max_players": 3}, true},
+		{map[string]interface{}{"max_players": float64(2.5)}, false},
+		{map[string]interface{}{"max_players": float64(0)}, false},
+		{map[string]interface{}{"max_players": float64(5)}, false},
+		{map[string]interface{}{"max_players": "2"}, false},
+		{map[string]interface{}{"mode": "ranked"}, true},
+		{map[string]interface{}{"mode": "hardcore"}, false},
+		{map[string]interface{}{"title": "anything goes"}, true},
+		{map[string]interface{}{"timer": true}, true},
+		{map[string]interface{}{"timer": "yes"}, false},
+		{map[string]interface{}{"colour": "red"}, false},
+	}
+	for _, c := range cases {
+		opts, err := testType.ValidateOptions(c.options)
+		if (err == nil) != c.ok {
+			t.Errorf("%v: error %v", c.options, err)
+			continue
+		}
+		if err == nil && opts["max_players"] == float64(2) {
+			t.Errorf("%v: seats wasn't turned into an int", c.options)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if _, ok := Lookup(mooseType); !ok {
+		t.Fatal("the moose isn't registered")
+	}
+	if _, ok := Lookup("NOPE"); ok {
+		t.Fatal("found a type that was never registered")
+	}
+	ts := Types()
+	for i := 1; i < len(ts); i++ {
+		if ts[i-1].Name >= ts[i].Name {
+			t.Fatalf("types aren't ordered by name: %s before %s", ts[i-1].Name, ts[i].Name)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering the moose twice didn't panic")
+		}
+	}()
+	Register(mooseGameType)
+}
+
+func TestCreateValidatesOptions(t *testing.T) {
+	if _, err := mooseGameType.Create("", map[string]interface{}{"max_players": float64(11)}, NewEnv()); err == nil {
+		t.Fatal("created a table above the maximum size")
+	}
+	g, err := mooseGameType.Create("", map[string]interface{}{"max_players": float64(6)}, NewEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown()
+	if g.Capacity() != 6 || g.Type() != mooseType || g.Name() == "" {
+		t.Fatalf("created a %s table '%s' for %d", g.Type(), g.Name(), g.Capacity())
+	}
+}
+
+func TestCreateFillsInIDAndName(t *testing.T) {
+	a, err := mooseGameType.Create("", nil, Env{Clock: NewManualClock(testStart)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mooseGameType.Create("", nil, Env{Clock: NewManualClock(testStart)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID() == "" || a.ID() == b.ID() || a.Name() == "" {
+		t.Fatalf("got ids '%s' & '%s', name '%s'", a.ID(), b.ID(), a.Name())
+	}
+	g, err := mooseGameType.Create("named", nil, Env{ID: "given", Clock: NewManualClock(testStart)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.ID() != "given" || g.Name() != "named" || g.Metadata().ID != "given" {
+		t.Fatalf("got '%s' - '%s'", g.ID(), g.Name())
+	}
+}
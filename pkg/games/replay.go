@@ -0,0 +1,59 @@
+package games
+
+import (
+	"fmt"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// Replay sets up a fresh copy of a game from its metadata and feeds it every logged input up to and
+// including step, returning the last state it sent along the way. The copy runs on a clock that never
+// moves, so the only timers it sees are the ones in the log. A copy that panics is reported as an error.
+func Replay(md gsinterfaces.GameMetadata, entries []gsinterfaces.LogEntry, step int) (*gsinterfaces.GameOutput, error) {
+	t, ok := Lookup(md.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown game type '%s'", md.Type)
+	}
+	g, err := t.Create(md.Name, md.Options, Env{
+		ID:    md.ID,
+		Clock: NewManualClock(md.Created),
+		Seed:  md.Seed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var state *gsinterfaces.GameOutput
+	g.SetFromGameHandler(func(gameUUID string, o *gsinterfaces.GameOutput) {
+		if !o.Transient {
+			state = o
+		}
+	})
+	crashed := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				crashed <- r
+				g.Shutdown()
+			}
+		}()
+		g.Run()
+	}()
+	defer g.Shutdown()
+	for _, e := range entries {
+		if e.Seq > step {
+			break
+		}
+		if !replayable(e.Input) {
+			continue
+		}
+		if err := g.Submit(*e.Input); err != nil {
+			select {
+			case r := <-crashed:
+				return nil, fmt.Errorf("game crashed replaying step %d: %v", e.Seq, r)
+			default:
+			}
+			return nil, fmt.Errorf("replaying step %d: %s", e.Seq, err)
+		}
+	}
+	return state, nil
+}
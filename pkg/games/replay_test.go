@@ -0,0 +1,87 @@
+package games
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// crashingGame is a moose table that panics on any player action
+type crashingGame struct {
+	*moose
+}
+
+func (g *crashingGame) Run() {
+	g.loop.Run(func(in gsinterfaces.Input) error {
+		if in.Kind == gsinterfaces.InputAction {
+			panic("boom")
+		}
+		return g.process(in)
+	})
+}
+
+func init() {
+	Register(&Type{
+		Name:       "TEST_CRASH",
+		MinPlayers: mooseMinPlayers,
+		MaxPlayers: mooseMaxPlayers,
+		New: func(name string, options map[string]interface{}, env Env) (gsinterfaces.Game, error) {
+			options, err := mooseGameType.ValidateOptions(nil)
+			if err != nil {
+				return nil, err
+			}
+			return &crashingGame{NewMoose(name, options, env)}, nil
+		},
+	})
+}
+
+// inputLog logs every input as a game's loop would
+func inputLog(ins ...gsinterfaces.Input) []gsinterfaces.LogEntry {
+	entries := []gsinterfaces.LogEntry{}
+	for i := range ins {
+		entries = append(entries, gsinterfaces.LogEntry{Seq: i + 1, At: testStart, Input: &ins[i]})
+	}
+	return entries
+}
+
+func TestReplay(t *testing.T) {
+	md := gsinterfaces.GameMetadata{ID: "g", Name: "replayed", Type: mooseType, Seed: 1, Created: testStart}
+	entries := inputLog(
+		gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: "p0"},
+		gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: "p1"},
+		gsinterfaces.Input{Kind: gsinterfaces.InputResync, User: "p0"},
+	)
+	state, err := Replay(md, entries, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Audience) != 1 || state.Audience[0] != "p0" {
+		t.Fatalf("step 1 has %v at the table", state.Audience)
+	}
+	state, err = Replay(md, entries, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Audience) != 2 {
+		t.Fatalf("step 3 has %v at the table", state.Audience)
+	}
+	if _, err := Replay(gsinterfaces.GameMetadata{Type: "NOPE"}, entries, 1); err == nil {
+		t.Fatal("replayed a game of an unknown type")
+	}
+}
+
+func TestReplayCrashedGame(t *testing.T) {
+	md := gsinterfaces.GameMetadata{ID: "g", Name: "crashed", Type: "TEST_CRASH", Seed: 1, Created: testStart}
+	entries := inputLog(
+		gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: "p0"},
+		gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: "p0", Payload: map[string]interface{}{"type": "TOGGLE_READY"}},
+	)
+	if _, err := Replay(md, entries, 1); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Replay(md, entries, 2)
+	if err == nil || !strings.Contains(err.Error(), "crashed replaying step 2: boom") {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package games
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// loopSnapshot saves a game built on a Loop as how it was set up plus every input it has accepted.
+// Since such a game only changes through its inputs, replaying them on the same seed brings it back
+// exactly, random number generator included.
+type loopSnapshot struct {
+	Metadata gsinterfaces.GameMetadata `json:"metadata"`
+	Inputs   []gsinterfaces.Input      `json:"inputs"`
+}
+
+func snapshotLog(md gsinterfaces.GameMetadata, l *EventLog) ([]byte, error) {
+	sn := loopSnapshot{Metadata: md, Inputs: []gsinterfaces.Input{}}
+	for _, e := range l.Entries() {
+		if replayable(e.Input) {
+			sn.Inputs = append(sn.Inputs, *e.Input)
+		}
+	}
+	return json.Marshal(sn)
+}
+
+// replayable reports whether an input has to be replayed to bring a game back. Resyncs only repeat the
+// state to one member & countdowns only tell the table how long is left, neither changes the game.
+func replayable(in *gsinterfaces.Input) bool {
+	switch {
+	case in == nil, in.Kind == gsinterfaces.InputResync:
+		return false
+	case in.Kind == gsinterfaces.InputTimer:
+		kind, _ := in.Payload["event"].(string)
+		return kind != TimerCountdown
+	}
+	return true
+}
+
+func decodeSnapshot(b []byte) (*loopSnapshot, error) {
+	sn := &loopSnapshot{}
+	if err := json.Unmarshal(b, sn); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+	return sn, nil
+}
+
+// replayInputs feeds a restored game its saved inputs before its loop is started
+func replayInputs(l *Loop, handle func(in gsinterfaces.Input) error, inputs []gsinterfaces.Input) error {
+	for i, in := range inputs {
+		if err := l.Replay(handle, in); err != nil {
+			return fmt.Errorf("restoring input %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package games
+
+import (
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// What a TIMER input is reporting
+const (
+	TimerExpired   = "EXPIRED"
+	TimerCountdown = "COUNTDOWN"
+)
+
+// Timers are a game's named deadlines. They arrive as TIMER inputs through the game's loop, so they're
+// handled just like a player's action, and like the rest of the game's state may only be used from it.
+type Timers struct {
+	loop   *Loop
+	clock  Clock
+	gen    uint64
+	active map[string]*deadline
+}
+
+type deadline struct {
+	at     time.Time
+	gen    uint64
+	every  time.Duration
+	expiry Timer
+	tick   Timer
+}
+
+func NewTimers(loop *Loop, clock Clock) *Timers {
+	return &Timers{
+		loop:   loop,
+		clock:  clock,
+		active: map[string]*deadline{},
+	}
+}
+
+// Set starts the named deadline d from now, replacing any earlier one of the same name. A countdown
+// above zero also fires a countdown input that often until the deadline.
+func (t *Timers) Set(name string, d, countdown time.Duration) {
+	t.Cancel(name)
+	t.gen++
+	dl := &deadline{
+		at:    t.clock.Now().Add(d),
+		gen:   t.gen,
+		every: countdown,
+	}
+	dl.expiry = t.clock.AfterFunc(d, t.fire(name, TimerExpired, dl.gen))
+	t.active[name] = dl
+	t.scheduleTick(name, dl)
+}
+
+func (t *Timers) Cancel(name string) {
+	dl, ok := t.active[name]
+	if !ok {
+		return
+	}
+	dl.expiry.Stop()
+	if dl.tick != nil {
+		dl.tick.Stop()
+	}
+	delete(t.active, name)
+}
+
+func (t *Timers) CancelAll() {
+	for name := range t.active {
+		t.Cancel(name)
+	}
+}
+
+// Deadline reports when the named timer runs out, if it's running
+func (t *Timers) Deadline(name string) (time.Time, bool) {
+	dl, ok := t.active[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return dl.at, true
+}
+
+// Fired makes sense of a TIMER input, reporting which timer it's for, whether it expired or is counting
+// down & how long is left. ok is false for a timer that was cancelled or set again since, which the game
+// should ignore.
+func (t *Timers) Fired(in gsinterfaces.Input) (name, kind string, remaining time.Duration, ok bool) {
+	name, _ = in.Payload["timer"].(string)
+	kind, _ = in.Payload["event"].(string)
+	var gen uint64
+	switch g := in.Payload["gen"].(type) {
+	case uint64:
+		gen = g
+	case float64:
+		// A timer read back from an encoded log
+		gen = uint64(g)
+	}
+	dl, active := t.active[name]
+	if !active || dl.gen != gen {
+		return name, kind, 0, false
+	}
+	if kind == TimerExpired {
+		t.Cancel(name)
+		return name, kind, 0, true
+	}
+	t.scheduleTick(name, dl)
+	return name, kind, dl.at.Sub(t.clock.Now()), true
+}
+
+// scheduleTick replaces any pending countdown, a countdown handled twice, e.g. while a game is restored,
+// would otherwise start a second chain of them
+func (t *Timers) scheduleTick(name string, dl *deadline) {
+	if dl.tick != nil {
+		dl.tick.Stop()
+	}
+	if dl.every <= 0 || dl.at.Sub(t.clock.Now()) <= dl.every {
+		dl.tick = nil
+		return
+	}
+	dl.tick = t.clock.AfterFunc(dl.every, t.fire(name, TimerCountdown, dl.gen))
+}
+
+// fire builds the clock callback that hands a timer to the game's loop
+func (t *Timers) fire(name, kind string, gen uint64) func() {
+	return func() {
+		t.loop.post(gsinterfaces.Input{
+			Kind: gsinterfaces.InputTimer,
+			Payload: map[string]interface{}{
+				"timer": name,
+				"event": kind,
+				"gen":   gen,
+			},
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package games
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+func pending(c *ManualClock) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.timers)
+}
+
+func timerInput(name, kind string, gen uint64) gsinterfaces.Input {
+	return gsinterfaces.Input{
+		Kind:    gsinterfaces.InputTimer,
+		Payload: map[string]interface{}{"timer": name, "event": kind, "gen": gen},
+	}
+}
+
+func TestTimers(t *testing.T) {
+	clock := NewManualClock(testStart)
+	timers := NewTimers(NewLoop(10, NewEventLog(clock)), clock)
+	timers.Set("turn", 10*time.Second, 2*time.Second)
+	if pending(clock) != 2 {
+		t.Fatalf("%d timers pending, want the deadline & one countdown", pending(clock))
+	}
+
+	clock.Advance(2 * time.Second)
+	name, kind, remaining, ok := timers.Fired(timerInput("turn", TimerCountdown, 1))
+	if !ok || name != "turn" || kind != TimerCountdown || remaining != 8*time.Second {
+		t.Fatalf("got %s %s %s %t", name, kind, remaining, ok)
+	}
+	// The same countdown handled again, like a restored game replaying its log, doesn't start a second chain
+	timers.Fired(timerInput("turn", TimerCountdown, 1))
+	if pending(clock) != 2 {
+		t.Fatalf("%d timers pending after a repeated countdown", pending(clock))
+	}
+
+	timers.Set("turn", time.Minute, 0)
+	if _, _, _, ok := timers.Fired(timerInput("turn", TimerExpired, 1)); ok {
+		t.Fatal("a timer that was set again since still fired")
+	}
+	if _, _, _, ok := timers.Fired(timerInput("turn", TimerExpired, 2)); !ok {
+		t.Fatal("the timer didn't fire")
+	}
+	if _, ok := timers.Deadline("turn"); ok || pending(clock) != 0 {
+		t.Fatal("an expired timer is still running")
+	}
+}
+
+func TestTimersCancel(t *testing.T) {
+	clock := NewManualClock(testStart)
+	timers := NewTimers(NewLoop(10, NewEventLog(clock)), clock)
+	timers.Set("a", time.Minute, time.Second)
+	timers.Set("b", time.Minute, 0)
+	timers.Cancel("a")
+	if _, ok := timers.Deadline("a"); ok || pending(clock) != 1 {
+		t.Fatalf("%d timers pending after cancelling one", pending(clock))
+	}
+	timers.CancelAll()
+	if pending(clock) != 0 {
+		t.Fatalf("%d timers pending after cancelling all of them", pending(clock))
+	}
+}
+
+func TestSnapshotLeavesOutResyncsAndCountdowns(t *testing.T) {
+	clock := NewManualClock(testStart)
+	l := NewEventLog(clock)
+	for _, in := range []gsinterfaces.Input{
+		{Kind: gsinterfaces.InputJoin, User: "p0"},
+		{Kind: gsinterfaces.InputResync, User: "p0"},
+		timerInput("turn", TimerCountdown, 1),
+		timerInput("turn", TimerExpired, 1),
+	} {
+		l.input(in)
+	}
+	b, err := snapshotLog(gsinterfaces.GameMetadata{ID: "g"}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn, err := decodeSnapshot(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sn.Inputs) != 2 || sn.Inputs[0].Kind != gsinterfaces.InputJoin || sn.Inputs[1].Payload["event"] != TimerExpired {
+		t.Fatalf("got %+v", sn.Inputs)
+	}
+}
@@ -1,28 +1,190 @@
 package gsinterfaces
 
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+)
+
 type Server interface {
 	GetUser(uuid string, name string) User
+	Connect(userUUID string, params ...interface{}) error
+	Handle(name string, h EventHandler)
+	Use(m ...EventMiddleware)
 	Shutdown(timeout int)
+	// Users, Games & EventStats are copies of what the server is up to at the time, for monitoring
+	Users() []UserInfo
+	Games() []GameInfo
+	EventStats() []EventStats
+	// WriteMetrics writes the server's metrics in the Prometheus text exposition format
+	WriteMetrics(w io.Writer) error
 	DebugAddUser(user User)
 	DebugAddGame(game Game)
 }
 
+// EventHandler handles a top-level event from a user whose payload has already been decoded into Data.
+// A returned error is reported back to the user.
+type EventHandler func(u User, e *event.General) error
+
+// EventMiddleware wraps an EventHandler to run code around it or stop it from running at all
+type EventMiddleware func(next EventHandler) EventHandler
+
 type User interface {
 	SetFromHandler(func(userUUID string, b []byte))
+	// SetDisconnectHandler sets what's called whenever the user is left without any connections
+	SetDisconnectHandler(func(userUUID string))
 	AddConnection(params ...interface{}) error
 	RemoveConnection(params ...interface{}) error
 	SendData(b []byte)
+	SendState(key string, b []byte)
+	Resume(lastSeq uint64) bool
+	QueueStats() QueueStats
+	Connections() int
 	SetName(n string) error
 	Name() string
 	ID() string
+	// Disconnect closes every connection of the user, telling them why
+	Disconnect(reason string)
 	Shutdown()
 }
 
+// Lifecycle states a game reports to the lobby
+const (
+	GameWaiting    = "WAITING"
+	GameInProgress = "IN_PROGRESS"
+	GameFinished   = "FINISHED"
+	// GameCrashed is set by the server on a game that panicked, the game itself never reports it
+	GameCrashed = "CRASHED"
+)
+
+// Kinds of input a game processes
+const (
+	InputJoin       = "JOIN"
+	InputLeave      = "LEAVE"
+	InputSpectate   = "SPECTATE"
+	InputUnspectate = "UNSPECTATE"
+	InputResync     = "RESYNC"
+	InputAction     = "ACTION"
+	InputTimer      = "TIMER"
+)
+
+// Input is one thing happening to a game: a user joining, leaving or acting, or one of its timers firing.
+type Input struct {
+	Kind    string                 `json:"kind"`
+	User    string                 `json:"user,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// LogEntry is one step in a game's history, either an input it accepted or an output it sent
+type LogEntry struct {
+	Seq    int             `json:"seq"`
+	At     time.Time       `json:"at"`
+	Input  *Input          `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// Game processes its inputs one at a time on its own loop, so game code never runs on two goroutines
+// at once. Status, Capacity, Players & Spectators can be called from anywhere and report the game as of
+// the last input it processed.
 type Game interface {
 	ID() string
 	Name() string
-	StartGameLoop()
-	FromUserHandler(uuid string, payload map[string]interface{})
-	SetFromGameHandler(func(userUUID string, gameuuid string, e interface{}))
+	Type() string
+	Status() string
+	Capacity() int
+	Players() []string
+	Spectators() []string
+	Metadata() GameMetadata
+	// Result is how the game ended, nil until it has
+	Result() *GameResult
+	// Snapshot saves the game so its type's Restore can bring it back, e.g. after a restart
+	Snapshot() ([]byte, error)
+	// Log is every input the game has accepted & every output it has sent so far, in order
+	Log() []LogEntry
+	// Submit queues an input for the game's loop and waits until it has been processed. It must not be
+	// called from the loop itself.
+	Submit(in Input) error
+	// Run is the game's loop, it returns once the game is shut down
+	Run()
+	SetFromGameHandler(func(gameUUID string, o *GameOutput))
 	Shutdown()
 }
+
+// GameMetadata is what it takes to set a game up again exactly as it was created. The seed gives away
+// every shuffle of the game so it must never reach players.
+type GameMetadata struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Options map[string]interface{} `json:"options"`
+	Seed    int64                  `json:"seed"`
+	Created time.Time              `json:"created"`
+}
+
+// GameResult is who won a game and how
+type GameResult struct {
+	Winners []string `json:"winners"`
+	Outcome string   `json:"outcome"`
+}
+
+// GameOutput is what a game hands back to the server to deliver. Public is sent to every user in
+// Audience, while each Private entry is only ever delivered to the user it is keyed by, on top of
+// the public part when that user is also in the Audience. Transient output, like a countdown, is
+// delivered as a one off message rather than as the game's latest state.
+type GameOutput struct {
+	Audience  []string               `json:"audience"`
+	Public    interface{}            `json:"public,omitempty"`
+	Private   map[string]interface{} `json:"private,omitempty"`
+	Transient bool                   `json:"transient,omitempty"`
+}
+
+// Contains reports whether id is one of ids, e.g. a user among a game's players
+func Contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// UserInfo is what the server knows about a user
+type UserInfo struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Account     string     `json:"account,omitempty"`
+	Role        string     `json:"role"`
+	Connections int        `json:"connections"`
+	Queue       QueueStats `json:"queue"`
+}
+
+// GameInfo is what the server knows about a game
+type GameInfo struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	Capacity   int       `json:"capacity"`
+	Players    []string  `json:"players"`
+	Spectators []string  `json:"spectators"`
+	Created    time.Time `json:"created"`
+}
+
+// EventStats counts how often an event was handled & how that went
+type EventStats struct {
+	Event  string        `json:"event"`
+	Calls  uint64        `json:"calls"`
+	Errors uint64        `json:"errors"`
+	Time   time.Duration `json:"time_ns"`
+}
+
+// QueueStats are the outbound queue counters of a user across all of their connections
+type QueueStats struct {
+	Depth           int    `json:"depth"`
+	Sent            uint64 `json:"sent"`
+	Dropped         uint64 `json:"dropped"`
+	Coalesced       uint64 `json:"coalesced"`
+	SlowDisconnects uint64 `json:"slow_disconnects"`
+}
@@ -0,0 +1,337 @@
+// Package metrics keeps counters, gauges & histograms and writes them out in the Prometheus text
+// exposition format, so the server can be scraped without pulling in the Prometheus client.
+//
+// Metrics are created once, usually as package level variables registered with Default, or in a Registry
+// of their own when there can be more than one of what they measure. Gauges that are cheaper to read than
+// to keep up to date are collected by a function at scrape time.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefBuckets are histogram buckets in seconds, fitting anything from a socket write to a slow handler
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the package level constructors create metrics in
+var Default = NewRegistry()
+
+// metric writes its HELP, TYPE & samples
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics keyed by name
+type Registry struct {
+	mtx     sync.RWMutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds a metric, replacing one registered earlier under the same name
+func (r *Registry) register(name string, m metric) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.metrics[name] = m
+}
+
+// Write writes every metric ordered by name
+func (r *Registry) Write(w io.Writer) error {
+	r.mtx.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	ms := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		ms = append(ms, r.metrics[name])
+	}
+	r.mtx.RUnlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return Handler(r.Write)
+}
+
+// Handler serves whatever write writes for Prometheus to scrape, usually one or more Registry.Write
+func Handler(write func(w io.Writer) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := write(w); err != nil {
+			log.Debugf("unable to write metrics: %s", err)
+		}
+	})
+}
+
+// family is what every kind of metric has in common, along with its children keyed by label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mtx    sync.RWMutex
+	keys   []string
+	values map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string][]string),
+	}
+}
+
+// child returns the key of the label values, calling create the first time they're seen
+func (f *family) child(values []string, create func(key string)) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: '%s' wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mtx.RLock()
+	_, ok := f.values[key]
+	f.mtx.RUnlock()
+	if ok {
+		return key
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+		sort.Strings(f.keys)
+		f.values[key] = append([]string(nil), values...)
+		create(key)
+	}
+	return key
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.kind)
+}
+
+// sample writes one line, extra is a label that's not part of the family like a histogram's le
+func (f *family) sample(w io.Writer, suffix string, values []string, extra string, v float64) {
+	fmt.Fprintf(w, "%s%s%s %s\n", f.name, suffix, labelString(f.labels, values, extra), formatFloat(v))
+}
+
+func labelString(names, values []string, extra string) string {
+	ls := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		ls = append(ls, n+`="`+escape(values[i])+`"`)
+	}
+	if extra != "" {
+		ls = append(ls, extra)
+	}
+	if len(ls) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(ls, ",") + "}"
+}
+
+// Label values escape backslashes, double quotes & line feeds, HELP text only the first & last
+var (
+	escaper     = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter only ever goes up
+type Counter struct {
+	n uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.n, n)
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	*family
+	counters map[string]*Counter
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: newFamily(name, help, "counter", labels), counters: make(map[string]*Counter)}
+	r.register(name, c)
+	return c
+}
+
+// NewCounter is a counter without labels
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// With returns the counter for the label values, in the order the labels were given
+func (c *CounterVec) With(values ...string) *Counter {
+	key := c.child(values, func(key string) { c.counters[key] = &Counter{} })
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.counters[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for _, key := range c.keys {
+		c.sample(w, "", c.values[key], "", float64(atomic.LoadUint64(&c.counters[key].n)))
+	}
+}
+
+// Histogram counts observations into buckets
+type Histogram struct {
+	mtx     sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	*family
+	buckets    []float64
+	histograms map[string]*Histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		family:     newFamily(name, help, "histogram", labels),
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+	}
+	r.register(name, h)
+	return h
+}
+
+// NewHistogram is a histogram without labels
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// With returns the histogram for the label values, in the order the labels were given
+func (h *HistogramVec) With(values ...string) *Histogram {
+	key := h.child(values, func(key string) {
+		h.histograms[key] = &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	})
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.histograms[key]
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	for _, key := range h.keys {
+		values, hist := h.values[key], h.histograms[key]
+		hist.mtx.Lock()
+		for i, b := range hist.buckets {
+			h.sample(w, "_bucket", values, `le="`+formatFloat(b)+`"`, float64(hist.counts[i]))
+		}
+		h.sample(w, "_bucket", values, `le="+Inf"`, float64(hist.count))
+		h.sample(w, "_sum", values, "", hist.sum)
+		h.sample(w, "_count", values, "", float64(hist.count))
+		hist.mtx.Unlock()
+	}
+}
+
+// Sample is one value of a gauge along with its label values
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type gaugeFunc struct {
+	*family
+	collect func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are collected by calling collect at scrape time. It
+// replaces any gauge registered under the same name.
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(name, &gaugeFunc{family: newFamily(name, help, "gauge", labels), collect: collect})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	g.header(w)
+	for _, s := range g.collect() {
+		if len(s.Labels) != len(g.labels) {
+			log.Errorf("metrics: '%s' collected %d label values, wants %d", g.name, len(s.Labels), len(g.labels))
+			continue
+		}
+		g.sample(w, "", s.Labels, "", s.Value)
+	}
+}
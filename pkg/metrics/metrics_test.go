@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// written is what m writes out
+func written(m metric) string {
+	var b bytes.Buffer
+	m.write(&b)
+	return b.String()
+}
+
+func TestCounterFormat(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests by path & code.", "path", "code")
+	c.With("/b", "200").Inc()
+	c.With("/a", "500").Add(2)
+	c.With("/b", "200").Inc()
+	want := `# HELP test_requests_total Requests by path & code.
+# TYPE test_requests_total counter
+test_requests_total{path="/a",code="500"} 2
+test_requests_total{path="/b",code="200"} 2
+`
+	if got := written(c); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	n := NewCounter("test_plain_total", "No labels.")
+	n.Inc()
+	if got := written(Default.metrics["test_plain_total"]); !strings.HasSuffix(got, "\ntest_plain_total 1\n") {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	c := NewCounterVec("test_escaped_total", "A \\ backslash,\na \"quoted\" line feed.", "value")
+	c.With("a \\ \"b\"\nc").Inc()
+	want := `# HELP test_escaped_total A \\ backslash,\na "quoted" line feed.
+# TYPE test_escaped_total counter
+test_escaped_total{value="a \\ \"b\"\nc"} 1
+`
+	if got := written(c); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramFormat(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Durations.", []float64{0.1, 1, 10}, "kind")
+	for _, v := range []float64{0.05, 0.1, 0.5, 5, 50} {
+		h.With("a").Observe(v)
+	}
+	want := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="a",le="0.1"} 2
+test_duration_seconds_bucket{kind="a",le="1"} 3
+test_duration_seconds_bucket{kind="a",le="10"} 4
+test_duration_seconds_bucket{kind="a",le="+Inf"} 5
+test_duration_seconds_sum{kind="a"} 55.65
+test_duration_seconds_count{kind="a"} 5
+`
+	if got := written(h); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	NewHistogram("test_plain_seconds", "No labels.", []float64{1}).Observe(2)
+	got := written(Default.metrics["test_plain_seconds"])
+	if !strings.Contains(got, "\ntest_plain_seconds_bucket{le=\"1\"} 0\ntest_plain_seconds_bucket{le=\"+Inf\"} 1\n") {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestLabelArity(t *testing.T) {
+	c := NewCounterVec("test_arity_total", "Two labels.", "a", "b")
+	h := NewHistogramVec("test_arity_seconds", "One label.", DefBuckets, "a")
+	for name, with := range map[string]func(){
+		"too few counter labels":    func() { c.With("x") },
+		"too many counter labels":   func() { c.With("x", "y", "z") },
+		"too few histogram labels":  func() { h.With() },
+		"too many histogram labels": func() { h.With("x", "y") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s didn't panic", name)
+				}
+			}()
+			with()
+		}()
+	}
+
+	// Gauges are collected at scrape time, so a bad sample is skipped instead
+	NewGaugeFunc("test_gauge", "Collected.", []string{"a"}, func() []Sample {
+		return []Sample{{Labels: []string{"x"}, Value: 1}, {Labels: nil, Value: 2}, {Labels: []string{"y"}, Value: math.Inf(1)}}
+	})
+	want := `# HELP test_gauge Collected.
+# TYPE test_gauge gauge
+test_gauge{a="x"} 1
+test_gauge{a="y"} +Inf
+`
+	if got := written(Default.metrics["test_gauge"]); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("b_total", "Test.")
+	r.NewCounterVec("a_total", "Test.", "label")
+	if _, ok := Default.metrics["a_total"]; ok {
+		t.Fatal("a metric made in a registry was also registered with Default")
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); strings.Index(got, "# HELP a_total") > strings.Index(got, "# HELP b_total") {
+		t.Fatalf("metrics aren't ordered by name:\n%s", got)
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Roles a user can have, each one may do everything the ones before it can
+const (
+	RolePlayer    = "player"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRanks = map[string]int{
+	RolePlayer:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ValidRole reports whether role is one of the roles above
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// ErrBanned is returned when a banned user tries to connect
+var ErrBanned = errors.New("banned from this server")
+
+const defaultAnnouncement = "Nothing new to report here."
+
+// profile loads what's stored about a user, or a blank profile if nothing is
+func (s *server) profile(id string) *storage.UserProfile {
+	p, err := s.store.LoadUser(id)
+	if err != nil {
+		if err != storage.ErrNotFound {
+			log.Errorf("unable to load user '%s': %s", id, err)
+		}
+		return &storage.UserProfile{ID: id}
+	}
+	return p
+}
+
+func (s *server) role(id string) string {
+	return roleOf(s.profile(id))
+}
+
+// roleOf is the role a profile gives, profiles only store the roles above player
+func roleOf(p *storage.UserProfile) string {
+	if p.Role != "" {
+		return p.Role
+	}
+	return RolePlayer
+}
+
+// requireRole only lets users with at least role through
+func (s *server) requireRole(role string) gsinterfaces.EventMiddleware {
+	return func(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+		return func(u gsinterfaces.User, e *event.General) error {
+			if roleRanks[s.role(u.ID())] < roleRanks[role] {
+				return fmt.Errorf("'%s' needs the %s role", e.Event, role)
+			}
+			return next(u, e)
+		}
+	}
+}
+
+// auditMiddleware records who tried which admin event with what & whether it went through
+func auditMiddleware(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		err := next(u, e)
+		entry := log.WithFields(log.Fields{
+			"audit":   true,
+			"event":   e.Event,
+			"user":    u.ID(),
+			"name":    u.Name(),
+			"payload": fmt.Sprintf("%+v", e.Data),
+		})
+		if err != nil {
+			entry.Warnf("failed: %s", err)
+		} else {
+			entry.Info("allowed")
+		}
+		return err
+	}
+}
+
+func (s *server) registerAdminHandlers() {
+	moderator := []gsinterfaces.EventMiddleware{auditMiddleware, s.requireRole(RoleModerator)}
+	admin := []gsinterfaces.EventMiddleware{auditMiddleware, s.requireRole(RoleAdmin)}
+	s.router.Handle("LIST_USERS", s.listUsersHandler, moderator...)
+	s.router.Handle("KICK_USER", s.kickUserHandler, moderator...)
+	s.router.Handle("END_GAME", s.endGameHandler, moderator...)
+	s.router.Handle("BAN_USER", s.banUserHandler, admin...)
+	s.router.Handle("UNBAN_USER", s.unbanUserHandler, admin...)
+	s.router.Handle("DELETE_GAME", s.deleteGameHandler, admin...)
+	s.router.Handle("ANNOUNCE", s.announceHandler, admin...)
+	s.router.Handle("SET_ROLE", s.setRoleHandler, admin...)
+}
+
+// outranks makes sure u may act on the user with id, nobody may act on someone of their own role or above
+func (s *server) outranks(u gsinterfaces.User, id string) error {
+	if r := s.role(id); roleRanks[s.role(u.ID())] <= roleRanks[r] {
+		return fmt.Errorf("not allowed to act on '%s', their role is %s", id, r)
+	}
+	return nil
+}
+
+func (s *server) connectedUser(id string) (gsinterfaces.User, bool) {
+	s.umtx.RLock()
+	defer s.umtx.RUnlock()
+	u, ok := s.users[id]
+	if !ok || u.Connections() == 0 {
+		return nil, false
+	}
+	return u, true
+}
+
+func (s *server) listUsersHandler(u gsinterfaces.User, e *event.General) error {
+	list := []gsinterfaces.UserInfo{}
+	for _, info := range s.Users() {
+		if info.Connections > 0 {
+			list = append(list, info)
+		}
+	}
+	u.SendData(event.WrapValues("USERS", map[string]interface{}{
+		"users": list,
+	}))
+	return nil
+}
+
+func (s *server) kickUserHandler(u gsinterfaces.User, e *event.General) error {
+	p := e.Data.(*event.UserRef)
+	if err := s.outranks(u, p.ID); err != nil {
+		return err
+	}
+	ku, ok := s.connectedUser(p.ID)
+	if !ok {
+		return fmt.Errorf("no user '%s' is connected", p.ID)
+	}
+	reason := p.Reason
+	if reason == "" {
+		reason = "kicked by a moderator"
+	}
+	ku.Disconnect(reason)
+	return nil
+}
+
+func (s *server) banUserHandler(u gsinterfaces.User, e *event.General) error {
+	p := e.Data.(*event.UserRef)
+	if err := s.outranks(u, p.ID); err != nil {
+		return err
+	}
+	if err := s.setBanned(p.ID, true); err != nil {
+		return err
+	}
+	if bu, ok := s.connectedUser(p.ID); ok {
+		reason := p.Reason
+		if reason == "" {
+			reason = ErrBanned.Error()
+		}
+		bu.Disconnect(reason)
+	}
+	return nil
+}
+
+func (s *server) unbanUserHandler(u gsinterfaces.User, e *event.General) error {
+	return s.setBanned(e.Data.(*event.UserRef).ID, false)
+}
+
+func (s *server) setBanned(id string, banned bool) error {
+	return s.updateProfile(id, func(p *storage.UserProfile) error {
+		if p.Created.IsZero() {
+			return fmt.Errorf("no user '%s'", id)
+		}
+		p.Banned = banned
+		return nil
+	})
+}
+
+// updateProfile lets f change a user's profile as one store update, so it can't undo any other, e.g. a
+// name change saving over a ban. Errors from f are passed on, the store's own are logged.
+func (s *server) updateProfile(id string, f func(p *storage.UserProfile) error) error {
+	var ferr error
+	err := s.store.UpdateUser(id, func(p *storage.UserProfile) error {
+		ferr = f(p)
+		return ferr
+	})
+	if err != nil && err != ferr {
+		log.Errorf("unable to update user '%s': %s", id, err)
+		return fmt.Errorf("unable to update user '%s' right now", id)
+	}
+	return err
+}
+
+func (s *server) endGameHandler(u gsinterfaces.User, e *event.General) error {
+	g, err := s.getGame(e.Data.(*event.GameRef).ID)
+	if err != nil {
+		return err
+	}
+	s.closeGame(g, "ended by a moderator")
+	return nil
+}
+
+// deleteGameHandler closes a game if it's still around and forgets its history
+func (s *server) deleteGameHandler(u gsinterfaces.User, e *event.General) error {
+	id := e.Data.(*event.GameRef).ID
+	if g, err := s.getGame(id); err == nil {
+		s.closeGame(g, "deleted by an admin")
+	}
+	if !s.forgetGame(id) {
+		return fmt.Errorf("no game '%s'", id)
+	}
+	return nil
+}
+
+func (s *server) announceHandler(u gsinterfaces.User, e *event.General) error {
+	msg := e.Data.(*event.Announce).Message
+	s.annmtx.Lock()
+	s.announcement = msg
+	s.annmtx.Unlock()
+	s.broadcast(event.WrapValue("ANNOUNCEMENTS", "message", msg))
+	return nil
+}
+
+func (s *server) currentAnnouncement() string {
+	s.annmtx.RLock()
+	defer s.annmtx.RUnlock()
+	return s.announcement
+}
+
+// setRoleHandler changes the role of someone ranked below u to one that's also below u's own
+func (s *server) setRoleHandler(u gsinterfaces.User, e *event.General) error {
+	p := e.Data.(*event.SetRole)
+	if p.ID == u.ID() {
+		return errors.New("not allowed to change your own role")
+	}
+	if err := s.outranks(u, p.ID); err != nil {
+		return err
+	}
+	if roleRanks[p.Role] >= roleRanks[s.role(u.ID())] {
+		return fmt.Errorf("not allowed to hand out the %s role", p.Role)
+	}
+	return s.updateProfile(p.ID, func(pr *storage.UserProfile) error {
+		if pr.Created.IsZero() {
+			return fmt.Errorf("no user '%s'", p.ID)
+		}
+		pr.Role = p.Role
+		if p.Role == RolePlayer {
+			pr.Role = ""
+		}
+		return nil
+	})
+}
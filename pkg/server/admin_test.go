@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/storage"
+)
+
+// withRoles adds a user with each role to the server, named after it
+func withRoles(t *testing.T, s *server, roles ...string) []*fakeUser {
+	t.Helper()
+	us := addUsers(s, roles...)
+	for _, role := range roles {
+		p := &storage.UserProfile{ID: role, Name: role, Created: time.Now(), Role: role}
+		if role == RolePlayer {
+			p.Role = ""
+		}
+		if err := s.store.SaveUser(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return us
+}
+
+// acked sends an event with a request_id & reports whether it was ACKed
+func acked(s *server, u *fakeUser, event string, payload string) bool {
+	n := len(u.received("ACK"))
+	send(s, u, fmt.Sprintf(`{"event":%q,"request_id":"r",%s}`, event, payload))
+	return len(u.received("ACK")) > n
+}
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t)
+	us := withRoles(t, s, RolePlayer, RoleModerator, RoleAdmin)
+	player, moderator, admin := us[0], us[1], us[2]
+	if acked(s, player, "LIST_USERS", `"x":0`) {
+		t.Fatal("a player listed users")
+	}
+	if !acked(s, moderator, "LIST_USERS", `"x":0`) || moderator.last("USERS") == nil {
+		t.Fatal("a moderator couldn't list users")
+	}
+	if acked(s, moderator, "ANNOUNCE", `"message":"hi"`) {
+		t.Fatal("a moderator made an announcement")
+	}
+	if !acked(s, admin, "ANNOUNCE", `"message":"hi"`) || player.last("ANNOUNCEMENTS")["message"] != "hi" {
+		t.Fatal("an admin couldn't make an announcement")
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	s := newTestServer(t)
+	admin := withRoles(t, s, RolePlayer, RoleModerator, RoleAdmin)[2]
+	addUsers(s, "other")
+	if err := s.store.SaveUser(&storage.UserProfile{ID: "other", Created: time.Now(), Role: RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		id, role string
+		ok       bool
+	}{
+		{"other", RolePlayer, false},
+		{RolePlayer, RoleAdmin, false},
+		{RoleAdmin, RolePlayer, false},
+		{"nobody", RoleModerator, false},
+		{RolePlayer, RoleModerator, true},
+		{RoleModerator, RolePlayer, true},
+	} {
+		if ok := acked(s, admin, "SET_ROLE", fmt.Sprintf(`"id":%q,"role":%q`, c.id, c.role)); ok != c.ok {
+			t.Errorf("making %s a %s: got %v", c.id, c.role, ok)
+		}
+	}
+	if s.role("other") != RoleAdmin {
+		t.Fatal("an admin demoted another admin")
+	}
+	if s.role(RolePlayer) != RoleModerator || s.role(RoleModerator) != RolePlayer {
+		t.Fatalf("got %s & %s", s.role(RolePlayer), s.role(RoleModerator))
+	}
+	if p := s.profile(RolePlayer); p.Name != RolePlayer {
+		t.Fatalf("changing the role lost the rest of the profile: %+v", p)
+	}
+}
+
+func TestBanUser(t *testing.T) {
+	s := newTestServer(t)
+	us := withRoles(t, s, RolePlayer, RoleModerator, RoleAdmin)
+	moderator, admin := us[1], us[2]
+	if acked(s, moderator, "BAN_USER", `"id":"player"`) {
+		t.Fatal("a moderator banned someone")
+	}
+	if acked(s, admin, "BAN_USER", fmt.Sprintf(`"id":"player","reason":%q`, strings.Repeat("x", 124))) {
+		t.Fatal("accepted a reason that doesn't fit in a close frame")
+	}
+	if !acked(s, admin, "BAN_USER", `"id":"player"`) {
+		t.Fatal("an admin couldn't ban a player")
+	}
+	if err := s.Connect(RolePlayer); err != ErrBanned {
+		t.Fatalf("a banned user connected: %v", err)
+	}
+	if !acked(s, admin, "UNBAN_USER", `"id":"player"`) || s.profile(RolePlayer).Banned {
+		t.Fatal("an admin couldn't unban a player")
+	}
+	if acked(s, admin, "BAN_USER", `"id":"admin"`) {
+		t.Fatal("an admin banned themself")
+	}
+}
+
+// slowStore takes its time handing over loaded users, so updates that aren't serialized would overlap
+type slowStore struct {
+	storage.Store
+}
+
+func (s slowStore) LoadUser(id string) (*storage.UserProfile, error) {
+	p, err := s.Store.LoadUser(id)
+	time.Sleep(20 * time.Millisecond)
+	return p, err
+}
+
+func TestProfileUpdatesDontUndoEachOther(t *testing.T) {
+	c := DefaultConfig()
+	c.Store = slowStore{storage.NewMemory()}
+	s := New(c).(*server)
+	u := withRoles(t, s, RolePlayer)[0]
+	if err := u.SetName("renamed"); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.saveUser(u)
+	}()
+	go func() {
+		defer wg.Done()
+		if err := s.setBanned(RolePlayer, true); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+	if p := s.profile(RolePlayer); !p.Banned || p.Name != "renamed" {
+		t.Fatalf("an update was lost: %+v", p)
+	}
+}
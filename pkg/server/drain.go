@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	log "github.com/Sirupsen/logrus"
+)
+
+// How often users are reminded the server is going down while it drains
+const drainNoticeEvery = 10 * time.Second
+
+// How long users & games get to close once the drain is over
+const closeTimeout = 5 * time.Second
+
+var errDraining = errors.New("server is shutting down")
+
+// draining reports whether Shutdown has started, from then on no new games or connections are accepted
+func (s *server) draining() bool {
+	select {
+	case <-s.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// drainGames gives in progress games until the deadline to finish, counting down to everyone meanwhile
+func (s *server) drainGames(deadline time.Time) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	var notice time.Time
+	for now := time.Now(); now.Before(deadline); now = <-tick.C {
+		if !now.Before(notice) {
+			s.broadcast(event.WrapValues("SERVER_SHUTTING_DOWN", map[string]interface{}{
+				"seconds":  int(deadline.Sub(now).Seconds() + 0.5),
+				"deadline": deadline,
+			}))
+			notice = now.Add(drainNoticeEvery)
+		}
+		n := s.gamesInProgress()
+		if n == 0 {
+			return
+		}
+		log.Debugf("waiting on %d games to finish", n)
+	}
+	log.Infof("%d games still in progress, they'll be restored from their snapshots", s.gamesInProgress())
+}
+
+func (s *server) gamesInProgress() int {
+	s.gmtx.RLock()
+	defer s.gmtx.RUnlock()
+	n := 0
+	for _, g := range s.games {
+		if g.Status() == gsinterfaces.GameInProgress {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *server) broadcast(b []byte) {
+	s.umtx.RLock()
+	for _, u := range s.users {
+		u.SendData(b)
+	}
+	s.umtx.RUnlock()
+}
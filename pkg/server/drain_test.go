@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownClosesConnectionsGoingAway(t *testing.T) {
+	s := newTestServer(t)
+	c := connect(t, s, "connected")
+	readEvent(t, c, "GREETING")
+
+	s.Shutdown(0)
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("got %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestNothingNewWhileDraining(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "host")[0]
+	close(s.drain)
+
+	send(s, u, `{"event":"CREATE_GAME","type":"MOOSE","request_id":"r1"}`)
+	if m := u.last("NACK"); m == nil || m["error"] != errDraining.Error() {
+		t.Fatalf("got NACK %v", m)
+	}
+	if err := s.Connect("late", nil); err != errDraining {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestNoGamesStartWhileDraining(t *testing.T) {
+	s := newTestServer(t)
+	host := addUsers(s, "host")[0]
+	id := createGame(t, s, host)
+	close(s.drain)
+
+	send(s, host, fmt.Sprintf(`{"event":"GAME","type":"START_GAME","id":"%s","request_id":"r1"}`, id))
+	if m := host.last("NACK"); m == nil || m["error"] != errDraining.Error() {
+		t.Fatalf("got NACK %v", m)
+	}
+	g, _ := s.getGame(id)
+	if g.Status() != gsinterfaces.GameWaiting {
+		t.Fatalf("game is %s", g.Status())
+	}
+}
+
+// closingStore notes whether it has been closed
+type closingStore struct {
+	storage.Store
+	mtx    sync.Mutex
+	closed bool
+}
+
+func (c *closingStore) Close() error {
+	c.mtx.Lock()
+	c.closed = true
+	c.mtx.Unlock()
+	return c.Store.Close()
+}
+
+// pairedUser only finishes shutting down once its partner has started to
+type pairedUser struct {
+	*fakeUser
+	s       *server
+	started chan struct{}
+	partner *pairedUser
+	met     bool
+}
+
+func (u *pairedUser) Shutdown() {
+	close(u.started)
+	// Users are free to reach back into the server while they close
+	u.s.Connect("newcomer-"+u.ID(), nil)
+	select {
+	case <-u.partner.started:
+		u.met = true
+	case <-time.After(time.Second):
+	}
+}
+
+func TestShutdownClosesUsersInParallel(t *testing.T) {
+	s := newTestServer(t)
+	store := &closingStore{Store: s.store}
+	s.store = store
+	a := &pairedUser{fakeUser: newFakeUser("a"), s: s, started: make(chan struct{})}
+	b := &pairedUser{fakeUser: newFakeUser("b"), s: s, started: make(chan struct{}), partner: a}
+	a.partner = b
+	s.DebugAddUser(a)
+	s.DebugAddUser(b)
+	c := connect(t, s, "connected")
+	readEvent(t, c, "GREETING")
+
+	start := time.Now()
+	s.Shutdown(0)
+	if time.Since(start) >= closeTimeout {
+		t.Fatal("gave up waiting on users")
+	}
+	if !a.met || !b.met {
+		t.Fatal("users were closed one after another")
+	}
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("got %v", err)
+			}
+			break
+		}
+	}
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	if !store.closed {
+		t.Fatal("the store wasn't closed")
+	}
+}
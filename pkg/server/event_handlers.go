@@ -6,93 +6,105 @@ import (
 	"github.com/GregoryDosh/game-server/pkg/event"
 	"github.com/GregoryDosh/game-server/pkg/games"
 	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
 	log "github.com/Sirupsen/logrus"
 )
 
-// validatePayloadKeys takes the event to check and a variable amount of keys to check for
-// ex validatePayloadKeys(e, "id", "name", "gameid")
-func validatePayloadKeys(e *event.General, keys ...string) error {
-	for _, k := range keys {
-		if _, ok := e.Payload[k]; !ok {
-			return fmt.Errorf("'%s' missing from payload keys", k)
-		}
-	}
-	return nil
-}
-
 func (s *server) broadcastHandler(u gsinterfaces.User, e *event.General) error {
 	log.Debugf("Sending broadcast to all users %s", e)
-
-	if err := validatePayloadKeys(e, "message"); err != nil {
-		return err
-	}
-	message, _ := e.Payload["message"]
-	fromUser := u.Name()
-	if m, ok := message.(string); ok {
-		s.umtx.RLock()
-		for _, bu := range s.users {
-			bu.SendData(event.WrapValues("GLOBAL_BROADCAST", map[string]interface{}{
-				"from":    fromUser,
-				"message": m,
-			}))
-		}
-		s.umtx.RUnlock()
-	}
+	p := e.Data.(*event.Broadcast)
+	s.broadcast(event.WrapValues("GLOBAL_BROADCAST", map[string]interface{}{
+		"from":    u.Name(),
+		"message": p.Message,
+	}))
 	return nil
 }
 
 func (s *server) createGameHandler(u gsinterfaces.User, e *event.General) error {
 	log.Debugf("'%s' - '%s' creating a new game of type '%s'", u.ID(), u.Name(), e)
-	if err := validatePayloadKeys(e, "type"); err != nil {
+	p := e.Data.(*event.CreateGame)
+	if s.draining() {
+		return errDraining
+	}
+	t, ok := games.Lookup(p.Type)
+	if !ok {
+		return fmt.Errorf("Unknown game type '%s'", p.Type)
+	}
+	ng, err := t.Create(p.Name, p.Options, games.NewEnv())
+	if err != nil {
 		return err
 	}
-	gameType, _ := e.Payload["type"]
-	if gt, ok := gameType.(string); ok {
-		switch gt {
-		case "MOOSE":
-			ng := games.NewMoose("")
-			s.gmtx.Lock()
-			s.games[ng.ID()] = ng
-			ng.SetFromGameHandler(s.eventFromGameHandler)
-			s.gmtx.Unlock()
-			u.SendData(event.WrapValues("GAME_CREATED", map[string]interface{}{
-				"id":   ng.ID(),
-				"name": ng.Name(),
-			}))
-		default:
-			return fmt.Errorf("Unknown game type '%s'", e.Payload)
-		}
+	md := ng.Metadata()
+	log.Infof("'%s' created game '%s' - '%s' of type '%s' with seed %d", u.ID(), md.ID, md.Name, md.Type, md.Seed)
+	if err := s.store.SaveGame(md); err != nil {
+		log.Errorf("unable to save game '%s': %s", md.ID, err)
 	}
+	ng = s.addGame(ng)
+	u.SendData(event.WrapValues("GAME_CREATED", map[string]interface{}{
+		"id":   ng.ID(),
+		"name": ng.Name(),
+		"type": t.Name,
+	}))
+	// Whoever creates a game takes the first seat
+	s.unwatchLobby(u.ID())
+	return ng.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: u.ID()})
+}
+
+func (s *server) listGameTypesHandler(u gsinterfaces.User, e *event.General) error {
+	u.SendData(event.WrapValues("GAME_TYPES", map[string]interface{}{
+		"types": games.Types(),
+	}))
 	return nil
 }
 
 func (s *server) changeUsernameHandler(u gsinterfaces.User, e *event.General) error {
 	log.Debugf("Trying to change username of '%s' from '%s' to '%s'", u.ID(), u.Name(), e)
-	if err := validatePayloadKeys(e, "name"); err != nil {
-		return err
+	p := e.Data.(*event.ChangeUsername)
+	if s.accounts.Taken(p.Name, u.ID()) {
+		return fmt.Errorf("'%s' belongs to a registered user", p.Name)
 	}
-	newName, _ := e.Payload["name"]
-	if name, ok := newName.(string); ok {
-		if err := u.SetName(name); err == nil {
-			u.SendData(event.WrapValue("USERNAME_CHANGED", "new_username", name))
-			return nil
-		}
+	if err := u.SetName(p.Name); err != nil {
+		return fmt.Errorf("Invalid username '%v'", p.Name)
 	}
-	return fmt.Errorf("Invalid username '%v'", newName)
+	s.saveUser(u)
+	u.SendData(event.WrapValue("USERNAME_CHANGED", "new_username", p.Name))
+	return nil
+}
+
+func (s *server) getStatsHandler(u gsinterfaces.User, e *event.General) error {
+	rs, err := s.store.Results(u.ID())
+	if err != nil {
+		log.Errorf("unable to load results of '%s': %s", u.ID(), err)
+		return fmt.Errorf("stats are unavailable right now")
+	}
+	u.SendData(event.WrapValues("STATS", map[string]interface{}{
+		"stats": storage.StatsFor(u.ID(), rs),
+	}))
+	return nil
+}
+
+// resumeHandler replays whatever a reconnecting client missed, falling back to resending the state
+// of every game they're part of when the gap is too big to replay.
+func (s *server) resumeHandler(u gsinterfaces.User, e *event.General) error {
+	p := e.Data.(*event.Resume)
+	if u.Resume(p.LastSeq) {
+		return nil
+	}
+	u.SendData(event.WrapValues("RESYNC", map[string]interface{}{}))
+	s.resyncGames(u)
+	return nil
 }
 
 func (s *server) gameEventHandler(u gsinterfaces.User, e *event.General) error {
 	log.Debugf("'%s' - '%s' sending game event of '%s'", u.ID(), u.Name(), e)
-	if err := validatePayloadKeys(e, "id"); err != nil {
-		return err
+	p := e.Data.(*event.Game)
+	// Games already under way get to finish while draining but none may start
+	if p.Type == "START_GAME" && s.draining() {
+		return errDraining
 	}
-	gameID, _ := e.Payload["id"]
-	if id, ok := gameID.(string); ok {
-		if g, ok := s.games[id]; ok {
-			g.FromUserHandler(u.ID(), e.Payload)
-			return nil
-		}
-		return fmt.Errorf("gameID '%s' does not exist", id)
+	g, err := s.getGame(p.ID)
+	if err != nil {
+		return err
 	}
-	return nil
+	return g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputAction, User: u.ID(), Payload: e.Payload})
 }
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/games"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// How many closed games keep their log around for reviews
+const maxArchivedGames = 100
+
+// gameRecord is what's left of a game once it has been closed
+type gameRecord struct {
+	status   string
+	metadata gsinterfaces.GameMetadata
+	log      []gsinterfaces.LogEntry
+}
+
+// archiveGame keeps the history of a closed game, forgetting the oldest one once there are too many
+func (s *server) archiveGame(g gsinterfaces.Game, status string) {
+	s.amtx.Lock()
+	defer s.amtx.Unlock()
+	id := g.ID()
+	if _, ok := s.archive[id]; !ok {
+		s.archiveOrder = append(s.archiveOrder, id)
+	}
+	s.archive[id] = &gameRecord{
+		status:   status,
+		metadata: g.Metadata(),
+		log:      publicLog(g.Log()),
+	}
+	for len(s.archiveOrder) > maxArchivedGames {
+		delete(s.archive, s.archiveOrder[0])
+		s.archiveOrder = s.archiveOrder[1:]
+	}
+}
+
+// forgetGame drops a closed game's history, returning false if there was none
+func (s *server) forgetGame(id string) bool {
+	s.amtx.Lock()
+	defer s.amtx.Unlock()
+	if _, ok := s.archive[id]; !ok {
+		return false
+	}
+	delete(s.archive, id)
+	for i, aid := range s.archiveOrder {
+		if aid == id {
+			s.archiveOrder = append(s.archiveOrder[:i], s.archiveOrder[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// gameRecord finds the history of a game, still running or already closed
+func (s *server) gameRecord(id string) (*gameRecord, error) {
+	if g, err := s.getGame(id); err == nil {
+		return &gameRecord{status: g.Status(), metadata: g.Metadata(), log: publicLog(g.Log())}, nil
+	}
+	s.amtx.RLock()
+	defer s.amtx.RUnlock()
+	if r, ok := s.archive[id]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("gameID '%s' does not exist", id)
+}
+
+// publicLog leaves each player's private view out of a game's outputs, keeping an archived game down
+// to its inputs & public state. The private views can always be had again by replaying the inputs.
+func publicLog(entries []gsinterfaces.LogEntry) []gsinterfaces.LogEntry {
+	public := make([]gsinterfaces.LogEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Output != nil {
+			o := gsinterfaces.GameOutput{}
+			if err := json.Unmarshal(e.Output, &o); err == nil && o.Private != nil {
+				o.Private = nil
+				if b, err := json.Marshal(&o); err == nil {
+					e.Output = b
+				}
+			}
+		}
+		public = append(public, e)
+	}
+	return public
+}
+
+// logMetadata is what a client gets to know about a game in its log, the seed stays on the server
+type logMetadata struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Options map[string]interface{} `json:"options"`
+	Created time.Time              `json:"created"`
+}
+
+// getGameLogHandler hands out the history of a game once it's over. A step replays the game up to that
+// point and sends its full state, every player's secrets included.
+func (s *server) getGameLogHandler(u gsinterfaces.User, e *event.General) error {
+	p := e.Data.(*event.GetGameLog)
+	r, err := s.gameRecord(p.ID)
+	if err != nil {
+		return err
+	}
+	if r.status != gsinterfaces.GameFinished && r.status != gsinterfaces.GameCrashed {
+		return fmt.Errorf("the log of game '%s' is only available once it's over", p.ID)
+	}
+	md := r.metadata
+	m := map[string]interface{}{
+		"id":       p.ID,
+		"metadata": logMetadata{ID: md.ID, Name: md.Name, Type: md.Type, Options: md.Options, Created: md.Created},
+		"log":      r.log,
+	}
+	if p.Step > 0 {
+		state, err := games.Replay(r.metadata, r.log, p.Step)
+		if err != nil {
+			return err
+		}
+		m["step"] = p.Step
+		m["state"] = state
+	}
+	u.SendData(event.WrapValues("GAME_LOG", m))
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+func TestGameLog(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "player")[0]
+	g := newStubGame("stub", "player")
+	g.log = []gsinterfaces.LogEntry{
+		{Seq: 1, Input: &gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: "player"}},
+		{Seq: 2, Output: []byte(`{"audience":["player"],"public":"table","private":{"player":"secret"}}`)},
+	}
+	s.DebugAddGame(g)
+
+	send(s, u, `{"event":"GET_GAME_LOG","id":"stub","request_id":"r1"}`)
+	if m := u.last("NACK"); m == nil || m["request_id"] != "r1" {
+		t.Fatalf("handed out the log of a game in progress: %v", u.last("GAME_LOG"))
+	}
+
+	check := func(when string) {
+		t.Helper()
+		m := u.last("GAME_LOG")
+		if m == nil {
+			t.Fatalf("no log %s", when)
+		}
+		md := m["metadata"].(map[string]interface{})
+		if md["id"] != "stub" || md["type"] != "STUB" {
+			t.Fatalf("got metadata %v %s", md, when)
+		}
+		if _, ok := md["seed"]; ok {
+			t.Fatalf("sent the seed %s", when)
+		}
+		entries := m["log"].([]interface{})
+		if len(entries) != 2 {
+			t.Fatalf("got %d entries %s", len(entries), when)
+		}
+		o := entries[1].(map[string]interface{})["output"].(map[string]interface{})
+		if o["public"] != "table" || o["private"] != nil {
+			t.Fatalf("got output %v %s", o, when)
+		}
+	}
+	g.finish("player")
+	send(s, u, `{"event":"GET_GAME_LOG","id":"stub"}`)
+	check("while the game is finishing")
+
+	now := time.Now()
+	s.reapGames(now)
+	s.reapGames(now.Add(s.config.FinishedGracePeriod + time.Second))
+	if _, err := s.getGame("stub"); err == nil {
+		t.Fatal("the game wasn't closed")
+	}
+	send(s, u, `{"event":"GET_GAME_LOG","id":"stub"}`)
+	check("once the game is archived")
+	if string(g.log[1].Output) != `{"audience":["player"],"public":"table","private":{"player":"secret"}}` {
+		t.Fatal("stripped the private views from the game's own log")
+	}
+}
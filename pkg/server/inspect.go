@@ -0,0 +1,61 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// Users lists every user the server has seen since it started, ordered by name
+func (s *server) Users() []gsinterfaces.UserInfo {
+	s.umtx.RLock()
+	us := make([]gsinterfaces.User, 0, len(s.users))
+	for _, u := range s.users {
+		us = append(us, u)
+	}
+	s.umtx.RUnlock()
+	infos := make([]gsinterfaces.UserInfo, 0, len(us))
+	for _, u := range us {
+		p := s.profile(u.ID())
+		infos = append(infos, gsinterfaces.UserInfo{
+			ID:          u.ID(),
+			Name:        u.Name(),
+			Account:     p.Account,
+			Role:        roleOf(p),
+			Connections: u.Connections(),
+			Queue:       u.QueueStats(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Games lists the games that haven't been closed yet, oldest first
+func (s *server) Games() []gsinterfaces.GameInfo {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+	infos := make([]gsinterfaces.GameInfo, 0, len(gs))
+	for _, g := range gs {
+		infos = append(infos, gsinterfaces.GameInfo{
+			ID:         g.ID(),
+			Name:       g.Name(),
+			Type:       g.Type(),
+			Status:     g.Status(),
+			Capacity:   g.Capacity(),
+			Players:    g.Players(),
+			Spectators: g.Spectators(),
+			Created:    g.Metadata().Created,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Created.Before(infos[j].Created) })
+	return infos
+}
+
+// EventStats are the counters of every event handled so far, ordered by event name
+func (s *server) EventStats() []gsinterfaces.EventStats {
+	return s.metrics.snapshot()
+}
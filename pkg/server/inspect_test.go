@@ -0,0 +1,43 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/storage"
+)
+
+// countingStore counts how often each user is loaded
+type countingStore struct {
+	storage.Store
+	mtx   sync.Mutex
+	loads map[string]int
+}
+
+func (c *countingStore) LoadUser(id string) (*storage.UserProfile, error) {
+	c.mtx.Lock()
+	c.loads[id]++
+	c.mtx.Unlock()
+	return c.Store.LoadUser(id)
+}
+
+func TestUsers(t *testing.T) {
+	store := &countingStore{Store: storage.NewMemory(), loads: map[string]int{}}
+	c := DefaultConfig()
+	c.Store = store
+	s := New(c).(*server)
+	addUsers(s, "b", "a")
+	store.SaveUser(&storage.UserProfile{ID: "a", Created: time.Now(), Account: "alice", Role: RoleModerator})
+
+	infos := s.Users()
+	if len(infos) != 2 || infos[0].ID != "a" || infos[1].ID != "b" {
+		t.Fatalf("got %+v", infos)
+	}
+	if infos[0].Account != "alice" || infos[0].Role != RoleModerator || infos[1].Account != "" || infos[1].Role != RolePlayer {
+		t.Fatalf("got %+v", infos)
+	}
+	if store.loads["a"] != 1 || store.loads["b"] != 1 {
+		t.Fatalf("loaded profiles %v times", store.loads)
+	}
+}
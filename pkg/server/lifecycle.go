@@ -0,0 +1,192 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+)
+
+// gameLifecycle is what the server remembers about a game to decide when it can be cleaned up
+type gameLifecycle struct {
+	status     string
+	since      time.Time
+	lastActive time.Time
+	// Whether the game's result has been stored
+	recorded bool
+}
+
+// addGame wires a game's output back through the server, starts tracking it under supervision & starts
+// its loop. The supervised game is what every later call should go through.
+func (s *server) addGame(ng gsinterfaces.Game) gsinterfaces.Game {
+	g := s.supervise(ng)
+	// Anyone may send to the game once it's listed, so its output has to have somewhere to go by then
+	g.SetFromGameHandler(s.eventFromGameHandler)
+	now := time.Now()
+	s.gmtx.Lock()
+	s.games[g.ID()] = g
+	s.lifecycles[g.ID()] = &gameLifecycle{
+		status:     gsinterfaces.GameWaiting,
+		since:      now,
+		lastActive: now,
+	}
+	s.gmtx.Unlock()
+	g.run()
+	return g
+}
+
+// lifecycleManager periodically reaps & snapshots games until the server shuts down
+func (s *server) lifecycleManager() {
+	log.Debug("started lifecycleManager")
+	defer log.Debug("stopped lifecycleManager")
+	// Shutdown waits on this before its final snapshot, so the two never overlap
+	defer close(s.managed)
+	reapTicker := time.NewTicker(s.config.ReapInterval)
+	defer reapTicker.Stop()
+	var snapshots <-chan time.Time
+	if s.config.SnapshotInterval > 0 {
+		snapshotTicker := time.NewTicker(s.config.SnapshotInterval)
+		defer snapshotTicker.Stop()
+		snapshots = snapshotTicker.C
+	}
+	for {
+		select {
+		case now := <-reapTicker.C:
+			s.reapGames(now)
+		case <-snapshots:
+			s.snapshotGames()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// reapGames closes games that finished or crashed more than the grace period ago, along with games nobody
+// has been connected to for longer than the idle timeout.
+func (s *server) reapGames(now time.Time) {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+
+	for _, g := range gs {
+		s.trackStatus(g, now)
+		connected := s.anyConnected(g)
+
+		s.gmtx.Lock()
+		l, ok := s.lifecycles[g.ID()]
+		if !ok {
+			s.gmtx.Unlock()
+			continue
+		}
+		if connected {
+			l.lastActive = now
+		}
+		status := l.status
+		over := status == gsinterfaces.GameFinished || status == gsinterfaces.GameCrashed
+		finished := over && now.Sub(l.since) > s.config.FinishedGracePeriod
+		idle := now.Sub(l.lastActive) > s.config.IdleTimeout
+		s.gmtx.Unlock()
+
+		switch {
+		case finished:
+			s.closeGame(g, strings.ToLower(status))
+		case idle:
+			s.closeGame(g, "abandoned")
+		}
+	}
+}
+
+// trackStatus notes when a game's status changes, storing its result as soon as it finishes. It's called
+// whenever the game sends something, with the reaper catching anything that changes quietly.
+func (s *server) trackStatus(g gsinterfaces.Game, now time.Time) {
+	status := g.Status()
+	s.gmtx.Lock()
+	l, ok := s.lifecycles[g.ID()]
+	record := false
+	if ok && l.status != status {
+		l.status = status
+		l.since = now
+		record = status == gsinterfaces.GameFinished && !l.recorded
+		l.recorded = l.recorded || record
+	}
+	s.gmtx.Unlock()
+	if record {
+		s.recordResult(g, now)
+	}
+}
+
+// recordResult stores how a game that just finished ended
+func (s *server) recordResult(g gsinterfaces.Game, now time.Time) {
+	s.gameSeconds.With(g.Type()).Observe(now.Sub(g.Metadata().Created).Seconds())
+	r := g.Result()
+	if r == nil {
+		return
+	}
+	err := s.store.SaveResult(&storage.GameResult{
+		GameID:   g.ID(),
+		Type:     g.Type(),
+		Players:  g.Players(),
+		Winners:  r.Winners,
+		Outcome:  r.Outcome,
+		Finished: now,
+	})
+	if err != nil {
+		log.Errorf("unable to save the result of game '%s': %s", g.ID(), err)
+	}
+}
+
+func (s *server) anyConnected(g gsinterfaces.Game) bool {
+	for _, id := range append(g.Players(), g.Spectators()...) {
+		s.umtx.RLock()
+		u, ok := s.users[id]
+		s.umtx.RUnlock()
+		if ok && u.Connections() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// closeGame forgets about a game, stops it & lets anyone still looking at it know it's gone
+func (s *server) closeGame(g gsinterfaces.Game, reason string) {
+	log.Infof("closing game '%s' - '%s': %s", g.ID(), g.Name(), reason)
+	s.gmtx.Lock()
+	l, ok := s.lifecycles[g.ID()]
+	recorded := ok && l.recorded
+	delete(s.games, g.ID())
+	delete(s.lifecycles, g.ID())
+	s.gmtx.Unlock()
+
+	members := append(g.Players(), g.Spectators()...)
+	status := g.Status()
+	g.Shutdown()
+	if status == gsinterfaces.GameFinished && !recorded {
+		s.recordResult(g, time.Now())
+	}
+	s.archiveGame(g, status)
+	if err := s.store.DeleteSnapshot(g.ID()); err != nil {
+		log.Errorf("unable to delete snapshot of game '%s': %s", g.ID(), err)
+	}
+
+	msg := event.WrapValues("GAME_CLOSED", map[string]interface{}{
+		"id":     g.ID(),
+		"reason": reason,
+	})
+	s.lmtx.Lock()
+	delete(s.lobbyCache, g.ID())
+	for w := range s.lobbyWatchers {
+		if !gsinterfaces.Contains(members, w) {
+			members = append(members, w)
+		}
+	}
+	s.lmtx.Unlock()
+	for _, id := range members {
+		s.GetUser(id, "").SendData(msg)
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	"github.com/gorilla/websocket"
+)
+
+// stubGame is a game the test steers by hand. Inputs are handed to onInput on the game's loop, while
+// onSnapshot, when set, saves the game.
+type stubGame struct {
+	id         string
+	created    time.Time
+	onInput    func(in gsinterfaces.Input) error
+	onSnapshot func() ([]byte, error)
+	handler    func(gameUUID string, o *gsinterfaces.GameOutput)
+	inputs     chan stubInput
+	done       chan struct{}
+	once       sync.Once
+	mtx        sync.Mutex
+	status     string
+	players    []string
+	result     *gsinterfaces.GameResult
+	log        []gsinterfaces.LogEntry
+}
+
+type stubInput struct {
+	in    gsinterfaces.Input
+	reply chan error
+}
+
+func newStubGame(id string, players ...string) *stubGame {
+	return &stubGame{
+		id:      id,
+		created: time.Now(),
+		inputs:  make(chan stubInput),
+		done:    make(chan struct{}),
+		status:  gsinterfaces.GameWaiting,
+		players: players,
+	}
+}
+
+func (g *stubGame) ID() string   { return g.id }
+func (g *stubGame) Name() string { return g.id }
+func (g *stubGame) Type() string { return "STUB" }
+
+func (g *stubGame) Status() string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.status
+}
+
+// finish ends the game with winners & lets the server know like a real game would
+func (g *stubGame) finish(winners ...string) {
+	g.mtx.Lock()
+	g.status = gsinterfaces.GameFinished
+	g.result = &gsinterfaces.GameResult{Winners: winners, Outcome: "test"}
+	g.mtx.Unlock()
+	g.handler(g.id, &gsinterfaces.GameOutput{Audience: g.Players(), Public: "over"})
+}
+
+func (g *stubGame) Capacity() int { return 10 }
+
+func (g *stubGame) Players() []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return append([]string{}, g.players...)
+}
+
+func (g *stubGame) Spectators() []string { return []string{} }
+
+func (g *stubGame) Metadata() gsinterfaces.GameMetadata {
+	return gsinterfaces.GameMetadata{ID: g.id, Name: g.id, Type: "STUB", Seed: 42, Created: g.created}
+}
+
+func (g *stubGame) Result() *gsinterfaces.GameResult {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.result
+}
+
+func (g *stubGame) Log() []gsinterfaces.LogEntry                                { return g.log }
+func (g *stubGame) SetFromGameHandler(h func(string, *gsinterfaces.GameOutput)) { g.handler = h }
+
+func (g *stubGame) Snapshot() ([]byte, error) {
+	if g.onSnapshot != nil {
+		return g.onSnapshot()
+	}
+	return nil, errors.New("stub games can't be saved")
+}
+
+func (g *stubGame) Submit(in gsinterfaces.Input) error {
+	si := stubInput{in: in, reply: make(chan error, 1)}
+	select {
+	case g.inputs <- si:
+	case <-g.done:
+		return errors.New("stopped")
+	}
+	select {
+	case err := <-si.reply:
+		return err
+	case <-g.done:
+		return errors.New("stopped")
+	}
+}
+
+func (g *stubGame) Run() {
+	for {
+		select {
+		case si := <-g.inputs:
+			var err error
+			if g.onInput != nil {
+				err = g.onInput(si.in)
+			}
+			si.reply <- err
+		case <-g.done:
+			return
+		}
+	}
+}
+
+func (g *stubGame) Shutdown() {
+	g.once.Do(func() { close(g.done) })
+}
+
+func TestReapAbandonedGames(t *testing.T) {
+	s := newTestServer(t)
+	host := addUsers(s, "host")[0]
+	id := createGame(t, s, host)
+	now := time.Now()
+
+	s.reapGames(now.Add(s.config.IdleTimeout / 2))
+	if _, err := s.getGame(id); err != nil {
+		t.Fatal("reaped a game before it went idle")
+	}
+	s.reapGames(now.Add(s.config.IdleTimeout + time.Second))
+	if _, err := s.getGame(id); err == nil {
+		t.Fatal("kept a game nobody is connected to")
+	}
+	if m := host.last("GAME_CLOSED"); m == nil || m["reason"] != "abandoned" {
+		t.Fatalf("closed with %v", m)
+	}
+	if _, err := s.gameRecord(id); err != nil {
+		t.Fatal("the closed game wasn't archived")
+	}
+}
+
+func TestReapFinishedGames(t *testing.T) {
+	s := newTestServer(t)
+	s.config.IdleTimeout = time.Hour
+	player := addUsers(s, "player")[0]
+	g := newStubGame("stub", "player")
+	s.DebugAddGame(g)
+	g.finish()
+
+	now := time.Now()
+	s.reapGames(now)
+	if _, err := s.getGame("stub"); err != nil {
+		t.Fatal("reaped a finished game before its grace period was up")
+	}
+	s.reapGames(now.Add(s.config.FinishedGracePeriod + time.Second))
+	if _, err := s.getGame("stub"); err == nil {
+		t.Fatal("kept a finished game past its grace period")
+	}
+	if m := player.last("GAME_CLOSED"); m == nil || m["reason"] != "finished" {
+		t.Fatalf("closed with %v", m)
+	}
+}
+
+func TestLobbyWatchersLeaveOnDisconnect(t *testing.T) {
+	s := newTestServer(t)
+	c := connect(t, s, "watcher")
+	readEvent(t, c, "GREETING")
+	c.WriteJSON(map[string]interface{}{"event": "LIST_GAMES"})
+	readEvent(t, c, "GAME_LIST")
+	watching := func() bool {
+		s.lmtx.Lock()
+		defer s.lmtx.Unlock()
+		return s.lobbyWatchers["watcher"]
+	}
+	if !watching() {
+		t.Fatal("listing games didn't start watching the lobby")
+	}
+	c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.Close()
+	eventually(t, "the watcher is forgotten", func() bool { return !watching() })
+}
+
+func TestResultRecordedWhenGameFinishes(t *testing.T) {
+	s := newTestServer(t)
+	addUsers(s, "player")
+	g := newStubGame("stub", "player")
+	s.DebugAddGame(g)
+	g.finish("player")
+	rs, err := s.store.Results("player")
+	if err != nil || len(rs) != 1 || rs[0].GameID != "stub" || rs[0].Winners[0] != "player" {
+		t.Fatalf("got %v, %v", rs, err)
+	}
+
+	// Neither the reaper nor closing the game stores it a second time
+	now := time.Now()
+	s.reapGames(now)
+	s.reapGames(now.Add(s.config.FinishedGracePeriod + time.Second))
+	if rs, _ := s.store.Results("player"); len(rs) != 1 {
+		t.Fatalf("got %v", rs)
+	}
+}
+
+func TestResultRecordedWhenClosed(t *testing.T) {
+	s := newTestServer(t)
+	addUsers(s, "player")
+	g := newStubGame("stub", "player")
+	s.DebugAddGame(g)
+	// Finished without a word to the server
+	g.mtx.Lock()
+	g.status = gsinterfaces.GameFinished
+	g.result = &gsinterfaces.GameResult{Winners: []string{}, Outcome: "test"}
+	g.mtx.Unlock()
+	s.closeGame(s.games["stub"], "finished")
+	if rs, _ := s.store.Results("player"); len(rs) != 1 {
+		t.Fatalf("got %v", rs)
+	}
+}
+
+func TestUnknownUsersArentSaved(t *testing.T) {
+	s := newTestServer(t)
+	s.GetUser("ghost", "")
+	if _, err := s.store.LoadUser("ghost"); err != storage.ErrNotFound {
+		t.Fatalf("saved a user that never connected: %v", err)
+	}
+	c := connect(t, s, "visitor")
+	readEvent(t, c, "GREETING")
+	if _, err := s.store.LoadUser("visitor"); err != nil {
+		t.Fatalf("didn't save a user that connected: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	log "github.com/Sirupsen/logrus"
+)
+
+type lobbyPlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type gameSummary struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Status     string        `json:"status"`
+	Capacity   int           `json:"capacity"`
+	Players    []lobbyPlayer `json:"players"`
+	Spectators int           `json:"spectators"`
+}
+
+func (s *server) summarizeGame(g gsinterfaces.Game) *gameSummary {
+	gs := &gameSummary{
+		ID:         g.ID(),
+		Name:       g.Name(),
+		Type:       g.Type(),
+		Status:     g.Status(),
+		Capacity:   g.Capacity(),
+		Players:    []lobbyPlayer{},
+		Spectators: len(g.Spectators()),
+	}
+	for _, p := range g.Players() {
+		gs.Players = append(gs.Players, lobbyPlayer{ID: p, Name: s.GetUser(p, "").Name()})
+	}
+	return gs
+}
+
+// getGame looks up a game by id
+func (s *server) getGame(id string) (gsinterfaces.Game, error) {
+	s.gmtx.RLock()
+	g, ok := s.games[id]
+	s.gmtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("gameID '%s' does not exist", id)
+	}
+	return g, nil
+}
+
+func (s *server) watchLobby(userUUID string) {
+	s.lmtx.Lock()
+	s.lobbyWatchers[userUUID] = true
+	s.lmtx.Unlock()
+}
+
+func (s *server) unwatchLobby(userUUID string) {
+	s.lmtx.Lock()
+	delete(s.lobbyWatchers, userUUID)
+	s.lmtx.Unlock()
+}
+
+// publishLobbyUpdate pushes a game's summary to everyone browsing the game list, but only when
+// something they can see has actually changed.
+func (s *server) publishLobbyUpdate(gameUUID string) {
+	g, err := s.getGame(gameUUID)
+	if err != nil {
+		return
+	}
+	gs := s.summarizeGame(g)
+	b, err := json.Marshal(gs)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	s.lmtx.Lock()
+	if s.lobbyCache[gameUUID] == string(b) {
+		s.lmtx.Unlock()
+		return
+	}
+	s.lobbyCache[gameUUID] = string(b)
+	watchers := make([]string, 0, len(s.lobbyWatchers))
+	for w := range s.lobbyWatchers {
+		watchers = append(watchers, w)
+	}
+	s.lmtx.Unlock()
+
+	msg := event.WrapValues("LOBBY_UPDATE", map[string]interface{}{
+		"game": gs,
+	})
+	for _, w := range watchers {
+		s.GetUser(w, "").SendState("lobby:"+gameUUID, msg)
+	}
+}
+
+func (s *server) listGamesHandler(u gsinterfaces.User, e *event.General) error {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+
+	summaries := make([]*gameSummary, 0, len(gs))
+	for _, g := range gs {
+		summaries = append(summaries, s.summarizeGame(g))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	s.watchLobby(u.ID())
+	u.SendData(event.WrapValues("GAME_LIST", map[string]interface{}{
+		"games": summaries,
+	}))
+	return nil
+}
+
+func (s *server) joinGameHandler(u gsinterfaces.User, e *event.General) error {
+	log.Debugf("'%s' - '%s' joining game '%s'", u.ID(), u.Name(), e)
+	g, err := s.getGame(e.Data.(*event.GameRef).ID)
+	if err != nil {
+		return err
+	}
+	if err := g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputJoin, User: u.ID()}); err != nil {
+		return err
+	}
+	s.unwatchLobby(u.ID())
+	u.SendData(event.WrapValue("GAME_JOINED", "id", g.ID()))
+	return nil
+}
+
+func (s *server) spectateGameHandler(u gsinterfaces.User, e *event.General) error {
+	log.Debugf("'%s' - '%s' spectating game '%s'", u.ID(), u.Name(), e)
+	g, err := s.getGame(e.Data.(*event.GameRef).ID)
+	if err != nil {
+		return err
+	}
+	if err := g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputSpectate, User: u.ID()}); err != nil {
+		return err
+	}
+	s.unwatchLobby(u.ID())
+	u.SendData(event.WrapValue("GAME_SPECTATING", "id", g.ID()))
+	return nil
+}
+
+func (s *server) leaveGameHandler(u gsinterfaces.User, e *event.General) error {
+	log.Debugf("'%s' - '%s' leaving game '%s'", u.ID(), u.Name(), e)
+	g, err := s.getGame(e.Data.(*event.GameRef).ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case gsinterfaces.Contains(g.Players(), u.ID()):
+		err = g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputLeave, User: u.ID()})
+	case gsinterfaces.Contains(g.Spectators(), u.ID()):
+		err = g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputUnspectate, User: u.ID()})
+	default:
+		err = fmt.Errorf("not a member of game '%s'", g.ID())
+	}
+	if err != nil {
+		return err
+	}
+	u.SendData(event.WrapValue("GAME_LEFT", "id", g.ID()))
+	return nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+// createGame has u create a table and returns its id
+func createGame(t *testing.T, s *server, u *fakeUser) string {
+	t.Helper()
+	send(s, u, `{"event":"CREATE_GAME","type":"MOOSE","name":"test"}`)
+	m := u.last("GAME_CREATED")
+	if m == nil {
+		t.Fatalf("no GAME_CREATED, errors %v", u.received("ERROR"))
+	}
+	return m["id"].(string)
+}
+
+func TestLobby(t *testing.T) {
+	s := newTestServer(t)
+	us := addUsers(s, "watcher", "host", "player", "spectator")
+	watcher, host, player, spectator := us[0], us[1], us[2], us[3]
+
+	send(s, watcher, `{"event":"LIST_GAMES"}`)
+	if l := watcher.last("GAME_LIST"); l == nil || len(l["games"].([]interface{})) != 0 {
+		t.Fatalf("game list %v", l)
+	}
+
+	id := createGame(t, s, host)
+	g, err := s.getGame(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps := g.Players(); len(ps) != 1 || ps[0] != "host" {
+		t.Fatalf("players after creating %v", ps)
+	}
+	if watcher.last("LOBBY_UPDATE") == nil {
+		t.Fatal("the lobby wasn't told about the new game")
+	}
+
+	send(s, player, fmt.Sprintf(`{"event":"JOIN_GAME","id":"%s"}`, id))
+	send(s, spectator, fmt.Sprintf(`{"event":"SPECTATE_GAME","id":"%s"}`, id))
+	if player.last("GAME_JOINED") == nil || spectator.last("GAME_SPECTATING") == nil {
+		t.Fatalf("join %v, spectate %v", player.received("ERROR"), spectator.received("ERROR"))
+	}
+	if len(g.Players()) != 2 || len(g.Spectators()) != 1 {
+		t.Fatalf("players %v, spectators %v", g.Players(), g.Spectators())
+	}
+	update := watcher.last("LOBBY_UPDATE")["game"].(map[string]interface{})
+	if len(update["players"].([]interface{})) != 2 || update["spectators"] != float64(1) {
+		t.Fatalf("lobby update %v", update)
+	}
+
+	send(s, player, fmt.Sprintf(`{"event":"LEAVE_GAME","id":"%s"}`, id))
+	send(s, spectator, fmt.Sprintf(`{"event":"LEAVE_GAME","id":"%s"}`, id))
+	if len(g.Players()) != 1 || len(g.Spectators()) != 0 {
+		t.Fatalf("players %v, spectators %v after leaving", g.Players(), g.Spectators())
+	}
+	send(s, player, fmt.Sprintf(`{"event":"LEAVE_GAME","id":"%s"}`, id))
+	if len(player.received("ERROR")) != 1 {
+		t.Fatal("left a game twice")
+	}
+
+	send(s, watcher, `{"event":"LIST_GAMES"}`)
+	if l := watcher.last("GAME_LIST")["games"].([]interface{}); len(l) != 1 {
+		t.Fatalf("game list %v", l)
+	}
+}
+
+func TestLobbyErrors(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "u")[0]
+	send(s, u, `{"event":"JOIN_GAME","id":"nope"}`)
+	send(s, u, `{"event":"CREATE_GAME","type":"NOPE"}`)
+	send(s, u, `{"event":"CREATE_GAME","type":"MOOSE","options":{"max_players":100}}`)
+	if errs := u.received("ERROR"); len(errs) != 3 {
+		t.Fatalf("errors %v", errs)
+	}
+	if u.last("GAME_CREATED") != nil {
+		t.Fatal("created a game anyway")
+	}
+}
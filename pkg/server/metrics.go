@@ -0,0 +1,69 @@
+package server
+
+import (
+	"io"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
+)
+
+// metricName is the event label for e, anything users make up is lumped together so they can't blow up
+// the number of series.
+func metricName(e *event.General) string {
+	if event.Registered(e.Event) {
+		return e.Event
+	}
+	return "unknown"
+}
+
+// registerMetrics creates the server's metrics in a registry of its own, so servers sharing a process
+// don't overwrite each other's gauges
+func (s *server) registerMetrics() {
+	r := metrics.NewRegistry()
+	s.registry = r
+	s.metrics = newEventMetrics(r)
+	s.gameSeconds = r.NewHistogramVec("gameserver_game_duration_seconds", "How long finished games took from being created by type.",
+		[]float64{60, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200}, "type")
+	r.NewGaugeFunc("gameserver_users_connected", "Users with at least one open connection.", nil, func() []metrics.Sample {
+		users, _ := s.connectionCounts()
+		return []metrics.Sample{{Value: float64(users)}}
+	})
+	r.NewGaugeFunc("gameserver_websocket_connections", "Open websocket connections.", nil, func() []metrics.Sample {
+		_, conns := s.connectionCounts()
+		return []metrics.Sample{{Value: float64(conns)}}
+	})
+	r.NewGaugeFunc("gameserver_games", "Games that haven't been closed yet by type & status.", []string{"type", "status"}, func() []metrics.Sample {
+		counts := map[[2]string]int{}
+		s.gmtx.RLock()
+		for _, g := range s.games {
+			counts[[2]string{g.Type(), g.Status()}]++
+		}
+		s.gmtx.RUnlock()
+		ss := make([]metrics.Sample, 0, len(counts))
+		for k, n := range counts {
+			ss = append(ss, metrics.Sample{Labels: []string{k[0], k[1]}, Value: float64(n)})
+		}
+		return ss
+	})
+}
+
+// WriteMetrics writes the server's metrics followed by the process wide ones in metrics.Default, like
+// the websocket counters
+func (s *server) WriteMetrics(w io.Writer) error {
+	if err := s.registry.Write(w); err != nil {
+		return err
+	}
+	return metrics.Default.Write(w)
+}
+
+func (s *server) connectionCounts() (users, conns int) {
+	s.umtx.RLock()
+	defer s.umtx.RUnlock()
+	for _, u := range s.users {
+		if n := u.Connections(); n > 0 {
+			users++
+			conns += n
+		}
+	}
+	return users, conns
+}
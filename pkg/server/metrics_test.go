@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// scraped is the value of the sample starting with series in what s serves, 0 if there's none
+func scraped(t *testing.T, s *server, series string) float64 {
+	t.Helper()
+	var b bytes.Buffer
+	if err := s.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestGameDurationRecordedWhenClosed(t *testing.T) {
+	s := newTestServer(t)
+	addUsers(s, "player")
+	g := newStubGame("stub", "player")
+	s.DebugAddGame(g)
+	if n := scraped(t, s, `gameserver_games{type="STUB",status="`+g.Status()+`"}`); n != 1 {
+		t.Fatalf("got %v games", n)
+	}
+	// Closed before the reaper ever saw it finish
+	g.mtx.Lock()
+	g.status = gsinterfaces.GameFinished
+	g.mtx.Unlock()
+	s.closeGame(s.games["stub"], "finished")
+	if n := scraped(t, s, `gameserver_game_duration_seconds_count{type="STUB"}`); n != 1 {
+		t.Fatalf("got %v game durations", n)
+	}
+}
+
+func TestMadeUpEventsShareAMetric(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "a")[0]
+	send(s, u, `{"event":"MADE_UP_1"}`)
+	send(s, u, `{"event":"MADE_UP_2"}`)
+	if n := scraped(t, s, `gameserver_events_received_total{event="unknown"}`); n != 2 {
+		t.Fatalf("got %v", n)
+	}
+	if n := scraped(t, s, `gameserver_events_received_total{event="MADE_UP_1"}`); n != 0 {
+		t.Fatal("a made up event got its own series")
+	}
+}
+
+func TestServersKeepTheirOwnMetrics(t *testing.T) {
+	a, b := newTestServer(t), newTestServer(t)
+	u := addUsers(a, "a")[0]
+	a.DebugAddGame(newStubGame("stub", "a"))
+	send(a, u, `{"event":"LIST_GAMES"}`)
+	if n := scraped(t, b, `gameserver_events_received_total{event="LIST_GAMES"}`); n != 0 {
+		t.Fatalf("another server's events were counted: %v", n)
+	}
+	var out bytes.Buffer
+	if err := a.WriteMetrics(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `gameserver_games{type="STUB",`) {
+		t.Fatalf("the first server's games were lost once a second server started:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "# TYPE gameserver_websocket_messages_sent_total counter") {
+		t.Fatal("didn't include the metrics in metrics.Default")
+	}
+}
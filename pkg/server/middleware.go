@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
+	log "github.com/Sirupsen/logrus"
+)
+
+// recoverMiddleware turns a panicking handler into an error for the user instead of a dead server
+func recoverMiddleware(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("handler for '%s' from '%s' panicked: %v\n%s", e.Event, u.ID(), r, debug.Stack())
+				err = fmt.Errorf("internal error handling '%s'", e.Event)
+			}
+		}()
+		return next(u, e)
+	}
+}
+
+func logMiddleware(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		start := time.Now()
+		err := next(u, e)
+		if err != nil {
+			log.Infof("'%s' from '%s' - '%s' failed after %s: %s", e.Event, u.ID(), u.Name(), time.Since(start), err)
+		} else {
+			log.Debugf("'%s' from '%s' - '%s' handled in %s", e.Event, u.ID(), u.Name(), time.Since(start))
+		}
+		return err
+	}
+}
+
+type eventMetrics struct {
+	received *metrics.CounterVec
+	errors   *metrics.CounterVec
+	seconds  *metrics.HistogramVec
+	mtx      sync.Mutex
+	// Keyed by metricName so unknown events users make up share a single entry
+	stats map[string]*gsinterfaces.EventStats
+}
+
+func newEventMetrics(r *metrics.Registry) *eventMetrics {
+	return &eventMetrics{
+		received: r.NewCounterVec("gameserver_events_received_total", "Events received from users by event.", "event"),
+		errors:   r.NewCounterVec("gameserver_event_errors_total", "Events whose handler returned an error by event.", "event"),
+		seconds:  r.NewHistogramVec("gameserver_event_duration_seconds", "How long handling an event took by event.", metrics.DefBuckets, "event"),
+		stats:    make(map[string]*gsinterfaces.EventStats),
+	}
+}
+
+func (m *eventMetrics) middleware(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		start := time.Now()
+		err := next(u, e)
+		elapsed := time.Since(start)
+		name := metricName(e)
+		m.received.With(name).Inc()
+		m.seconds.With(name).Observe(elapsed.Seconds())
+		if err != nil {
+			m.errors.With(name).Inc()
+		}
+		m.mtx.Lock()
+		st, ok := m.stats[name]
+		if !ok {
+			st = &gsinterfaces.EventStats{Event: name}
+			m.stats[name] = st
+		}
+		st.Calls++
+		st.Time += elapsed
+		if err != nil {
+			st.Errors++
+		}
+		m.mtx.Unlock()
+		return err
+	}
+}
+
+// snapshot copies the counters ordered by event name
+func (m *eventMetrics) snapshot() []gsinterfaces.EventStats {
+	m.mtx.Lock()
+	ss := make([]gsinterfaces.EventStats, 0, len(m.stats))
+	for _, st := range m.stats {
+		ss = append(ss, *st)
+	}
+	m.mtx.Unlock()
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Event < ss[j].Event })
+	return ss
+}
+
+var errRateLimited = errors.New("too many events, slow down")
+
+// rateLimiter gives every user a token bucket refilled at rate per second holding up to burst tokens
+type rateLimiter struct {
+	mtx     sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *rateLimiter) allow(userUUID string, now time.Time) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[userUUID]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[userUUID] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep forgets the buckets that have had time to refill completely, at most once per refill. A user
+// coming back gets a full bucket either way. It's called with the lock held.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < refill {
+		return
+	}
+	l.swept = now
+	for id, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+func (l *rateLimiter) middleware(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		if !l.allow(u.ID(), time.Now()) {
+			return errRateLimited
+		}
+		return next(u, e)
+	}
+}
+
+// requirePlayer only lets players of the game named in the payload through
+func (s *server) requirePlayer(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		g, err := s.getGame(e.Data.(*event.Game).ID)
+		if err != nil {
+			return err
+		}
+		if !gsinterfaces.Contains(g.Players(), u.ID()) {
+			return fmt.Errorf("not a player in game '%s'", g.ID())
+		}
+		return next(u, e)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	h := recoverMiddleware(func(gsinterfaces.User, *event.General) error {
+		panic("boom")
+	})
+	err := h(newFakeUser("u"), &event.General{Event: "LIST_GAMES"})
+	if err == nil || err.Error() != "internal error handling 'LIST_GAMES'" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", now) {
+			t.Fatalf("event %d within the burst was limited", i)
+		}
+	}
+	if l.allow("a", now) {
+		t.Fatal("allowed past the burst")
+	}
+	if !l.allow("b", now) {
+		t.Fatal("one user's bucket limited another")
+	}
+	if !l.allow("a", now.Add(500*time.Millisecond)) || l.allow("a", now.Add(500*time.Millisecond)) {
+		t.Fatal("didn't refill one token after half a second")
+	}
+}
+
+func TestRateLimiterForgetsIdleUsers(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+	l.allow("idle", now)
+	l.allow("busy", now)
+	// A full refill takes 1.5s
+	later := now.Add(2 * time.Second)
+	l.allow("busy", later.Add(-time.Second))
+	l.allow("other", later)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Fatal("kept the bucket of a user that's been idle long enough to refill")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Fatal("dropped a bucket that's still refilling")
+	}
+}
+
+func TestEventMetricsLumpUnknownEvents(t *testing.T) {
+	m := newEventMetrics(metrics.NewRegistry())
+	h := m.middleware(unknownEvent)
+	u := newFakeUser("u")
+	for _, name := range []string{"MADE_UP", "ALSO_MADE_UP", "LIST_GAMES"} {
+		h(u, &event.General{Event: name})
+	}
+	ss := m.snapshot()
+	if len(ss) != 2 || ss[0].Event != "LIST_GAMES" || ss[1].Event != "unknown" {
+		t.Fatalf("got %+v", ss)
+	}
+	if ss[1].Calls != 2 || ss[1].Errors != 2 {
+		t.Fatalf("got %+v", ss[1])
+	}
+}
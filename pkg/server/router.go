@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// router hands each top-level event to the handler registered for it, wrapped in the shared middleware.
+type router struct {
+	mtx        sync.RWMutex
+	routes     map[string]gsinterfaces.EventHandler
+	middleware []gsinterfaces.EventMiddleware
+}
+
+func newRouter() *router {
+	return &router{
+		routes: make(map[string]gsinterfaces.EventHandler),
+	}
+}
+
+// Handle registers the handler for an event along with middleware that only applies to it. The event's
+// payload has to be declared with event.Register, it's decoded before any of the route's middleware runs.
+// Handle panics if the event already has a handler.
+func (r *router) Handle(name string, h gsinterfaces.EventHandler, mw ...gsinterfaces.EventMiddleware) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.routes[name]; ok {
+		panic(fmt.Sprintf("server: Handle called twice for '%s'", name))
+	}
+	r.routes[name] = decode(chain(h, mw))
+}
+
+// Use adds middleware run around every event, including unknown ones. The first one added runs outermost.
+func (r *router) Use(mw ...gsinterfaces.EventMiddleware) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+func (r *router) dispatch(u gsinterfaces.User, e *event.General) error {
+	r.mtx.RLock()
+	h, ok := r.routes[e.Event]
+	mw := r.middleware
+	r.mtx.RUnlock()
+	if !ok {
+		h = unknownEvent
+	}
+	return chain(h, mw)(u, e)
+}
+
+func chain(h gsinterfaces.EventHandler, mw []gsinterfaces.EventMiddleware) gsinterfaces.EventHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+func decode(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+	return func(u gsinterfaces.User, e *event.General) error {
+		if err := event.Decode(e); err != nil {
+			return err
+		}
+		return next(u, e)
+	}
+}
+
+func unknownEvent(u gsinterfaces.User, e *event.General) error {
+	return fmt.Errorf("unknown event '%s'", e.Event)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// trace is middleware that notes when it runs
+func trace(ran *[]string, name string) gsinterfaces.EventMiddleware {
+	return func(next gsinterfaces.EventHandler) gsinterfaces.EventHandler {
+		return func(u gsinterfaces.User, e *event.General) error {
+			*ran = append(*ran, name)
+			return next(u, e)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := newRouter()
+	ran := []string{}
+	r.Use(trace(&ran, "outer"), trace(&ran, "inner"))
+	r.Handle("CHANGE_USERNAME", func(u gsinterfaces.User, e *event.General) error {
+		ran = append(ran, "handler:"+e.Data.(*event.ChangeUsername).Name)
+		return nil
+	}, trace(&ran, "route"))
+
+	u := newFakeUser("u")
+	e := &event.General{Event: "CHANGE_USERNAME", Payload: map[string]interface{}{"name": "bob"}}
+	if err := r.dispatch(u, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(ran); got != "[outer inner route handler:bob]" {
+		t.Fatalf("ran %s", got)
+	}
+
+	// Payloads are decoded before the route's own middleware
+	ran = ran[:0]
+	err := r.dispatch(u, &event.General{Event: "CHANGE_USERNAME", Payload: map[string]interface{}{}})
+	if _, ok := err.(*event.ValidationError); !ok {
+		t.Fatalf("got %v", err)
+	}
+	if got := fmt.Sprint(ran); got != "[outer inner]" {
+		t.Fatalf("ran %s", got)
+	}
+
+	// Unknown events still go through the shared middleware
+	ran = ran[:0]
+	if err := r.dispatch(u, &event.General{Event: "NOPE"}); err == nil || err.Error() != "unknown event 'NOPE'" {
+		t.Fatalf("got %v", err)
+	}
+	if got := fmt.Sprint(ran); got != "[outer inner]" {
+		t.Fatalf("ran %s", got)
+	}
+}
+
+func TestRouterHandleTwice(t *testing.T) {
+	r := newRouter()
+	h := func(gsinterfaces.User, *event.General) error { return nil }
+	r.Handle("LIST_GAMES", h)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a handler twice didn't panic")
+		}
+	}()
+	r.Handle("LIST_GAMES", h)
+}
+
+func TestRouterErrors(t *testing.T) {
+	r := newRouter()
+	boom := errors.New("boom")
+	r.Handle("LIST_GAMES", func(gsinterfaces.User, *event.General) error { return boom })
+	if err := r.dispatch(newFakeUser("u"), &event.General{Event: "LIST_GAMES"}); err != boom {
+		t.Fatalf("got %v", err)
+	}
+}
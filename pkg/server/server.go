@@ -2,29 +2,115 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"sync"
 	"time"
 
+	"github.com/GregoryDosh/game-server/pkg/accounts"
 	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/games"
 	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/metrics"
+	"github.com/GregoryDosh/game-server/pkg/storage"
 	ws "github.com/GregoryDosh/game-server/pkg/websocket"
 	log "github.com/Sirupsen/logrus"
 )
 
+// Config tunes how the server looks after games & users
+type Config struct {
+	// How long a finished game sticks around so players can look over the result
+	FinishedGracePeriod time.Duration
+	// How long a game can go without any of its players or spectators connected
+	IdleTimeout time.Duration
+	// How often games are checked against the above
+	ReapInterval time.Duration
+	// Outbound queue every user connection gets
+	Queue ws.QueueConfig
+	// How many events per second a user may send on average, 0 turns rate limiting off
+	EventRate float64
+	// How many events a user may send in a quick burst
+	EventBurst int
+	// Where users, games & results are kept, nil only keeps them in memory
+	Store storage.Store
+	// Registered accounts, display names may not pass for them. Nil uses the accounts kept in Store.
+	Accounts *accounts.Accounts
+	// How often running games are saved to the store, 0 only saves them on shutdown
+	SnapshotInterval time.Duration
+}
+
+// DefaultConfig returns the settings used when nothing else is configured
+func DefaultConfig() Config {
+	return Config{
+		FinishedGracePeriod: 5 * time.Minute,
+		IdleTimeout:         30 * time.Minute,
+		ReapInterval:        time.Minute,
+		Queue:               ws.DefaultQueueConfig(),
+		EventRate:           10,
+		EventBurst:          20,
+		SnapshotInterval:    30 * time.Second,
+	}
+}
+
 type server struct {
-	umtx  sync.RWMutex
-	users map[string]gsinterfaces.User
-	gmtx  sync.RWMutex
-	games map[string]gsinterfaces.Game
+	config     Config
+	store      storage.Store
+	accounts   *accounts.Accounts
+	drain      chan struct{}
+	stop       chan struct{}
+	managed    chan struct{}
+	router     *router
+	metrics    *eventMetrics
+	umtx       sync.RWMutex
+	users      map[string]gsinterfaces.User
+	gmtx       sync.RWMutex
+	games      map[string]gsinterfaces.Game
+	lifecycles map[string]*gameLifecycle
+	lmtx       sync.Mutex
+	// Users currently browsing the game list & the last summary pushed to them per game
+	lobbyWatchers map[string]bool
+	lobbyCache    map[string]string
+	amtx          sync.RWMutex
+	// Histories of closed games, oldest first in archiveOrder
+	archive      map[string]*gameRecord
+	archiveOrder []string
+	annmtx       sync.RWMutex
+	announcement string
+	// Metrics of this server, scraped along with metrics.Default by WriteMetrics
+	registry    *metrics.Registry
+	gameSeconds *metrics.HistogramVec
 }
 
-func New() gsinterfaces.Server {
-	return &server{
-		users: make(map[string]gsinterfaces.User),
-		games: make(map[string]gsinterfaces.Game),
+func New(c Config) gsinterfaces.Server {
+	s := &server{
+		config:        c,
+		store:         c.Store,
+		drain:         make(chan struct{}),
+		stop:          make(chan struct{}),
+		managed:       make(chan struct{}),
+		users:         make(map[string]gsinterfaces.User),
+		games:         make(map[string]gsinterfaces.Game),
+		lifecycles:    make(map[string]*gameLifecycle),
+		archive:       make(map[string]*gameRecord),
+		lobbyWatchers: make(map[string]bool),
+		lobbyCache:    make(map[string]string),
+		router:        newRouter(),
+		announcement:  defaultAnnouncement,
+	}
+	if s.store == nil {
+		s.store = storage.NewMemory()
+	}
+	s.accounts = c.Accounts
+	if s.accounts == nil {
+		s.accounts = accounts.New(s.store)
+	}
+	s.registerMetrics()
+	s.Use(logMiddleware, s.metrics.middleware, recoverMiddleware)
+	if c.EventRate > 0 {
+		s.Use(newRateLimiter(c.EventRate, c.EventBurst).middleware)
 	}
+	s.registerHandlers()
+	s.restoreGames()
+	go s.lifecycleManager()
+	return s
 }
 
 func (s *server) GetUser(uuid, name string) gsinterfaces.User {
@@ -32,8 +118,17 @@ func (s *server) GetUser(uuid, name string) gsinterfaces.User {
 	u, ok := s.users[uuid]
 	s.umtx.RUnlock()
 	if !ok {
-		nu := ws.NewUser(uuid, name)
+		// Users seen before get their old name back
+		p, err := s.store.LoadUser(uuid)
+		switch {
+		case err == nil:
+			name = p.Name
+		case err != storage.ErrNotFound:
+			log.Errorf("unable to load user '%s': %s", uuid, err)
+		}
+		nu := ws.NewUser(uuid, name, s.config.Queue)
 		nu.SetFromHandler(s.eventFromUserHandler)
+		nu.SetDisconnectHandler(s.unwatchLobby)
 		s.umtx.Lock()
 		s.users[uuid] = nu
 		s.umtx.Unlock()
@@ -42,77 +137,211 @@ func (s *server) GetUser(uuid, name string) gsinterfaces.User {
 	return u
 }
 
+// Connect adds a connection to a user and catches them up on the announcements & any game they're in,
+// e.g. one that was restored after a restart. Only users that actually connect are remembered, not every
+// id a game mentions. Banned users are turned away.
+func (s *server) Connect(userUUID string, params ...interface{}) error {
+	if s.draining() {
+		return errDraining
+	}
+	if s.profile(userUUID).Banned {
+		return ErrBanned
+	}
+	u := s.GetUser(userUUID, "")
+	if err := u.AddConnection(params...); err != nil {
+		return err
+	}
+	if _, err := s.store.LoadUser(userUUID); err == storage.ErrNotFound {
+		s.saveUser(u)
+	}
+	u.SendData(event.WrapValue("ANNOUNCEMENTS", "message", s.currentAnnouncement()))
+	s.resyncGames(u)
+	return nil
+}
+
+// saveUser stores the user's profile, keeping when they were first seen
+func (s *server) saveUser(u gsinterfaces.User) {
+	err := s.store.UpdateUser(u.ID(), func(p *storage.UserProfile) error {
+		if p.Created.IsZero() {
+			p.Created = time.Now()
+		}
+		p.Name = u.Name()
+		return nil
+	})
+	if err != nil {
+		log.Errorf("unable to save user '%s': %s", u.ID(), err)
+	}
+}
+
+// Shutdown drains the server: no new games or connections are accepted while in progress games get up
+// to timeout seconds to finish. Whatever is still running after that is stopped & snapshotted, then
+// every connection is closed.
 func (s *server) Shutdown(timeout int) {
-	timeoutTicker := time.NewTicker(time.Duration(timeout) * time.Second)
-	done := make(chan bool)
-	go func(done chan bool) {
-		s.umtx.RLock()
-		for _, u := range s.users {
+	close(s.drain)
+	s.drainGames(time.Now().Add(time.Duration(timeout) * time.Second))
+	close(s.stop)
+	<-s.managed
+	s.stopGames()
+	s.snapshotGames()
+	s.closeUsers()
+	if err := s.store.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
+// closeUsers closes every user's connections at once, giving up on the ones that take too long
+func (s *server) closeUsers() {
+	s.umtx.RLock()
+	us := make([]gsinterfaces.User, 0, len(s.users))
+	for _, u := range s.users {
+		us = append(us, u)
+	}
+	s.umtx.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, u := range us {
+		wg.Add(1)
+		go func(u gsinterfaces.User) {
+			defer wg.Done()
 			u.Shutdown()
-		}
-		s.umtx.RUnlock()
-		s.gmtx.RLock()
-		for _, g := range s.games {
-			g.Shutdown()
-		}
-		s.gmtx.RUnlock()
+		}(u)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
 		close(done)
-	}(done)
-	for {
-		select {
-		case <-done:
-			log.Info("closed all connections")
-			return
-		case <-timeoutTicker.C:
-			log.Warn("not all connections closed before timeout")
-			return
-		}
+	}()
+	select {
+	case <-done:
+		log.Info("closed all connections")
+	case <-time.After(closeTimeout):
+		log.Warn("not all connections closed before timeout")
 	}
 }
 
-func (s *server) DebugAddUser(n string, u gsinterfaces.User) {
+func (s *server) DebugAddUser(u gsinterfaces.User) {
 	s.umtx.Lock()
-	s.users[n] = u
+	s.users[u.ID()] = u
 	s.umtx.Unlock()
 }
 
+func (s *server) DebugAddGame(g gsinterfaces.Game) {
+	s.addGame(g)
+}
+
+// registerHandlers sets up the server's own events and those brought along by game types
+func (s *server) registerHandlers() {
+	s.Handle("BROADCAST", s.broadcastHandler)
+	s.Handle("CREATE_GAME", s.createGameHandler)
+	s.Handle("LIST_GAME_TYPES", s.listGameTypesHandler)
+	s.Handle("LIST_GAMES", s.listGamesHandler)
+	s.Handle("JOIN_GAME", s.joinGameHandler)
+	s.Handle("LEAVE_GAME", s.leaveGameHandler)
+	s.Handle("SPECTATE_GAME", s.spectateGameHandler)
+	s.Handle("RESUME", s.resumeHandler)
+	s.router.Handle("GAME", s.gameEventHandler, s.requirePlayer)
+	s.Handle("CHANGE_USERNAME", s.changeUsernameHandler)
+	s.Handle("GET_GAME_LOG", s.getGameLogHandler)
+	s.Handle("GET_STATS", s.getStatsHandler)
+	s.registerAdminHandlers()
+	for _, t := range games.Types() {
+		for name, h := range t.Events {
+			s.Handle(name, h)
+		}
+	}
+}
+
+// Handle registers a top-level event, its payload needs to be declared with event.Register.
+func (s *server) Handle(name string, h gsinterfaces.EventHandler) {
+	s.router.Handle(name, h)
+}
+
+// Use wraps every event the server handles in more middleware
+func (s *server) Use(m ...gsinterfaces.EventMiddleware) {
+	s.router.Use(m...)
+}
+
 func (s *server) eventFromUserHandler(userUUID string, b []byte) {
-	u := s.GetUser(userUUID, "")
+	var u gsinterfaces.User = s.GetUser(userUUID, "")
 	log.Debugf("Received from '%s' this message: %s", u.Name(), b)
 	e := &event.General{}
 	if err := json.Unmarshal(b, &e); err != nil {
 		log.Error(err)
 	}
-	log.Warn(e)
-	switch e.Event {
-	case "BROADCAST":
-		if err := s.broadcastHandler(u, e); err != nil {
-			u.SendData(event.WrapError(err))
-		}
-	case "CREATE_GAME":
-		if err := s.createGameHandler(u, e); err != nil {
-			u.SendData(event.WrapError(err))
-		}
-	case "GAME":
-		if err := s.gameEventHandler(u, e); err != nil {
-			u.SendData(event.WrapError(err))
+	if e.RequestID != "" {
+		u = &replyUser{User: u, requestID: e.RequestID}
+	}
+	respond(u, e, s.router.dispatch(u, e))
+}
+
+// replyUser stamps everything sent directly back to the user while handling a request with its request_id
+type replyUser struct {
+	gsinterfaces.User
+	requestID string
+}
+
+func (r *replyUser) SendData(b []byte) {
+	r.User.SendData(event.WithRequestID(b, r.requestID))
+}
+
+func (r *replyUser) SendState(key string, b []byte) {
+	r.User.SendState(key, event.WithRequestID(b, r.requestID))
+}
+
+// respond reports how handling an event went. Clients that sent a request_id always get an ACK or NACK,
+// everyone else only hears about errors.
+func respond(u gsinterfaces.User, e *event.General, err error) {
+	switch {
+	case e.RequestID == "" && err != nil:
+		u.SendData(event.WrapError(err))
+	case e.RequestID == "":
+	case err != nil:
+		nack := map[string]interface{}{
+			"for":   e.Event,
+			"error": err.Error(),
 		}
-	case "CHANGE_USERNAME":
-		if err := s.changeUsernameHandler(u, e); err != nil {
-			u.SendData(event.WrapError(err))
+		if verr, ok := err.(*event.ValidationError); ok {
+			nack["fields"] = verr.Fields
 		}
+		u.SendData(event.WrapValues("NACK", nack))
 	default:
-		m := fmt.Sprintf("unknown event from '%s': '%s'", userUUID, e.Event)
-		log.Infof(m)
-		u.SendData(event.WrapError(errors.New(m)))
+		u.SendData(event.WrapValue("ACK", "for", e.Event))
 	}
 }
 
-func (s *server) eventFromGameHandler(userUUID string, gameUUID string, e interface{}) {
-	log.Debugf("game %s wants to send to %s: %s", gameUUID, userUUID, e)
-	u := s.GetUser(userUUID, "")
-	u.SendData(event.WrapValues("GAME_EVENT", map[string]interface{}{
-		"id":            gameUUID,
-		"event_details": e,
-	}))
+func (s *server) eventFromGameHandler(gameUUID string, o *gsinterfaces.GameOutput) {
+	log.Debugf("game %s wants to send to %v: %v", gameUUID, o.Audience, o.Public)
+	sent := map[string]bool{}
+	for _, userUUID := range o.Audience {
+		if sent[userUUID] {
+			continue
+		}
+		sent[userUUID] = true
+		m := map[string]interface{}{
+			"id":     gameUUID,
+			"public": o.Public,
+		}
+		if p, ok := o.Private[userUUID]; ok {
+			m["private"] = p
+		}
+		if o.Transient {
+			s.GetUser(userUUID, "").SendData(event.WrapValues("GAME_EVENT", m))
+			continue
+		}
+		s.GetUser(userUUID, "").SendState("game:"+gameUUID, event.WrapValues("GAME_EVENT", m))
+	}
+	// Private overlays for anyone outside the audience, e.g. an error for a user that isn't seated
+	for userUUID, p := range o.Private {
+		if sent[userUUID] {
+			continue
+		}
+		s.GetUser(userUUID, "").SendData(event.WrapValues("GAME_EVENT", map[string]interface{}{
+			"id":      gameUUID,
+			"private": p,
+		}))
+	}
+	if g, err := s.getGame(gameUUID); err == nil {
+		s.trackStatus(g, time.Now())
+	}
+	s.publishLobbyUpdate(gameUUID)
 }
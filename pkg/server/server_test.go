@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	ws "github.com/GregoryDosh/game-server/pkg/websocket"
+	"github.com/gorilla/websocket"
+)
+
+// fakeUser keeps everything sent to it instead of writing it to a websocket
+type fakeUser struct {
+	*ws.User
+	mtx  sync.Mutex
+	sent []map[string]interface{}
+}
+
+func newFakeUser(id string) *fakeUser {
+	return &fakeUser{User: ws.NewUser(id, id, ws.DefaultQueueConfig())}
+}
+
+func (u *fakeUser) SendData(b []byte) {
+	u.record(b)
+}
+
+func (u *fakeUser) SendState(key string, b []byte) {
+	u.record(b)
+}
+
+func (u *fakeUser) record(b []byte) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		panic(err)
+	}
+	u.mtx.Lock()
+	u.sent = append(u.sent, m)
+	u.mtx.Unlock()
+}
+
+// received lists every message of an event sent to the user so far
+func (u *fakeUser) received(name string) []map[string]interface{} {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	ms := []map[string]interface{}{}
+	for _, m := range u.sent {
+		if m["event"] == name {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// last is the latest message of an event sent to the user, nil if there's none
+func (u *fakeUser) last(name string) map[string]interface{} {
+	ms := u.received(name)
+	if len(ms) == 0 {
+		return nil
+	}
+	return ms[len(ms)-1]
+}
+
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	return New(DefaultConfig()).(*server)
+}
+
+// addUsers adds a fake user to the server for every id
+func addUsers(s *server, ids ...string) []*fakeUser {
+	us := make([]*fakeUser, 0, len(ids))
+	for _, id := range ids {
+		u := newFakeUser(id)
+		s.DebugAddUser(u)
+		us = append(us, u)
+	}
+	return us
+}
+
+// send hands the server an event as if it had come in over u's websocket
+func send(s *server, u *fakeUser, msg string) {
+	s.eventFromUserHandler(u.ID(), []byte(msg))
+}
+
+// connect opens a websocket to the server as the user with id
+func connect(t *testing.T, s *server, id string) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := s.Connect(id, c); err != nil {
+			c.Close()
+		}
+	}))
+	t.Cleanup(hs.Close)
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// readEvent reads from c until a message of the event arrives
+func readEvent(t *testing.T, c *websocket.Conn, name string) map[string]interface{} {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		m := map[string]interface{}{}
+		if err := c.ReadJSON(&m); err != nil {
+			t.Fatalf("waiting on %s: %s", name, err)
+		}
+		if m["event"] == name {
+			return m
+		}
+	}
+}
+
+// eventually fails the test if ok doesn't hold within a few seconds
+func eventually(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGameOutputPrivateViews(t *testing.T) {
+	s := newTestServer(t)
+	us := addUsers(s, "a", "b", "c")
+	s.eventFromGameHandler("g", &gsinterfaces.GameOutput{
+		Audience: []string{"a", "b", "a"},
+		Public:   "table",
+		Private: map[string]interface{}{
+			"a": "hand of a",
+			"c": "notice for c",
+		},
+	})
+	a, b, c := us[0].received("GAME_EVENT"), us[1].received("GAME_EVENT"), us[2].received("GAME_EVENT")
+	if len(a) != 1 || a[0]["public"] != "table" || a[0]["private"] != "hand of a" {
+		t.Errorf("a got %v", a)
+	}
+	if len(b) != 1 || b[0]["public"] != "table" || b[0]["private"] != nil {
+		t.Errorf("b got %v", b)
+	}
+	if len(c) != 1 || c[0]["public"] != nil || c[0]["private"] != "notice for c" {
+		t.Errorf("c got %v", c)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "a")[0]
+
+	send(s, u, `{"event":"LIST_GAME_TYPES","request_id":"r1"}`)
+	if m := u.last("GAME_TYPES"); m == nil || m["request_id"] != "r1" {
+		t.Fatalf("reply not stamped: %v", m)
+	}
+	if m := u.last("ACK"); m == nil || m["request_id"] != "r1" || m["for"] != "LIST_GAME_TYPES" {
+		t.Fatalf("got ACK %v", m)
+	}
+
+	send(s, u, `{"event":"CREATE_GAME","request_id":"r2"}`)
+	m := u.last("NACK")
+	if m == nil || m["request_id"] != "r2" || m["for"] != "CREATE_GAME" || m["error"] == "" {
+		t.Fatalf("got NACK %v", m)
+	}
+	if fields, ok := m["fields"].([]interface{}); !ok || len(fields) != 1 || fields[0].(map[string]interface{})["field"] != "type" {
+		t.Fatalf("NACK is missing the failing field: %v", m)
+	}
+	send(s, u, `{"event":"NOT_AN_EVENT","request_id":"r3"}`)
+	if m := u.last("NACK"); m == nil || m["request_id"] != "r3" {
+		t.Fatalf("got NACK %v", m)
+	}
+	if len(u.received("ERROR")) != 0 {
+		t.Fatal("sent an ERROR alongside a NACK")
+	}
+}
+
+func TestNoRequestID(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "a")[0]
+
+	send(s, u, `{"event":"LIST_GAME_TYPES"}`)
+	if m := u.last("GAME_TYPES"); m == nil || m["request_id"] != nil {
+		t.Fatalf("got %v", m)
+	}
+	send(s, u, `{"event":"CREATE_GAME"}`)
+	if len(u.received("ACK")) != 0 || len(u.received("NACK")) != 0 {
+		t.Fatal("acknowledged a request without a request_id")
+	}
+	if m := u.last("ERROR"); m == nil || m["request_id"] != nil {
+		t.Fatalf("got ERROR %v", m)
+	}
+}
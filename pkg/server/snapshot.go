@@ -0,0 +1,119 @@
+package server
+
+import (
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/games"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	"github.com/GregoryDosh/game-server/pkg/storage"
+	log "github.com/Sirupsen/logrus"
+)
+
+// snapshotGames saves every game still being played so it survives a restart, and drops the snapshots
+// of games that are over.
+func (s *server) snapshotGames() {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+
+	for _, g := range gs {
+		switch g.Status() {
+		case gsinterfaces.GameFinished, gsinterfaces.GameCrashed:
+			if err := s.store.DeleteSnapshot(g.ID()); err != nil {
+				log.Errorf("unable to delete snapshot of game '%s': %s", g.ID(), err)
+			}
+			continue
+		}
+		b, err := g.Snapshot()
+		if err != nil {
+			log.Errorf("unable to snapshot game '%s': %s", g.ID(), err)
+			continue
+		}
+		err = s.store.SaveSnapshot(&storage.Snapshot{
+			GameID: g.ID(),
+			Type:   g.Type(),
+			Data:   b,
+			Taken:  time.Now(),
+		})
+		if err != nil {
+			log.Errorf("unable to save snapshot of game '%s': %s", g.ID(), err)
+		}
+	}
+}
+
+// stopGames shuts every game down and waits for their loops to return, so none of them changes while
+// it's being saved
+func (s *server) stopGames() {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+	for _, g := range gs {
+		g.Shutdown()
+	}
+	timeout := time.After(closeTimeout)
+	for _, g := range gs {
+		sg, ok := g.(*supervisedGame)
+		if !ok {
+			continue
+		}
+		select {
+		case <-sg.stopped:
+		case <-timeout:
+			log.Warn("not all games stopped before timeout")
+			return
+		}
+	}
+}
+
+// restoreGames brings back every game saved by the last run of the server
+func (s *server) restoreGames() {
+	sns, err := s.store.Snapshots()
+	if err != nil {
+		log.Errorf("unable to load game snapshots: %s", err)
+		return
+	}
+	for _, sn := range sns {
+		s.restoreGame(sn)
+	}
+}
+
+func (s *server) restoreGame(sn storage.Snapshot) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("restoring game '%s' panicked: %v", sn.GameID, r)
+		}
+	}()
+	t, ok := games.Lookup(sn.Type)
+	if !ok || t.Restore == nil {
+		log.Warnf("unable to restore game '%s', type '%s' can't be restored", sn.GameID, sn.Type)
+		return
+	}
+	g, err := t.Restore(sn.Data, games.SystemClock)
+	if err != nil {
+		log.Errorf("unable to restore game '%s': %s", sn.GameID, err)
+		return
+	}
+	s.addGame(g)
+	log.Infof("restored game '%s' - '%s' from %s", g.ID(), g.Name(), sn.Taken)
+}
+
+// resyncGames sends a user the current state of every game they're playing or watching
+func (s *server) resyncGames(u gsinterfaces.User) {
+	s.gmtx.RLock()
+	gs := make([]gsinterfaces.Game, 0, len(s.games))
+	for _, g := range s.games {
+		gs = append(gs, g)
+	}
+	s.gmtx.RUnlock()
+	for _, g := range gs {
+		if gsinterfaces.Contains(g.Players(), u.ID()) || gsinterfaces.Contains(g.Spectators(), u.ID()) {
+			g.Submit(gsinterfaces.Input{Kind: gsinterfaces.InputResync, User: u.ID()})
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+func TestRestoreGames(t *testing.T) {
+	s := newTestServer(t)
+	host := addUsers(s, "host")[0]
+	id := createGame(t, s, host)
+	s.snapshotGames()
+
+	c := DefaultConfig()
+	c.Store = s.store
+	restarted := New(c).(*server)
+	g, err := restarted.getGame(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Name() != "test" || !gsinterfaces.Contains(g.Players(), "host") {
+		t.Fatalf("restored '%s' with %v", g.Name(), g.Players())
+	}
+}
+
+func TestShutdownStopsGamesBeforeSnapshot(t *testing.T) {
+	s := newTestServer(t)
+	g := newStubGame("stub", "player")
+	g.status = gsinterfaces.GameInProgress
+	s.DebugAddGame(g)
+	sg := s.games["stub"].(*supervisedGame)
+	g.onSnapshot = func() ([]byte, error) {
+		select {
+		case <-sg.stopped:
+			return []byte("saved"), nil
+		default:
+			return nil, errors.New("snapshotted while the game was still running")
+		}
+	}
+
+	s.Shutdown(0)
+	sns, err := s.store.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sns) != 1 || sns[0].GameID != "stub" || string(sns[0].Data) != "saved" {
+		t.Fatalf("got %+v", sns)
+	}
+}
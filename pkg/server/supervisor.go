@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+	log "github.com/Sirupsen/logrus"
+	uuid "github.com/satori/go.uuid"
+)
+
+// supervisedGame runs a game's loop behind a recover. A game that panics is marked as crashed and shut
+// down, the rest of the server carries on.
+type supervisedGame struct {
+	gsinterfaces.Game
+	s       *server
+	mtx     sync.RWMutex
+	errorID string
+	// Closed once the game's loop has returned
+	stopped chan struct{}
+}
+
+func (s *server) supervise(g gsinterfaces.Game) *supervisedGame {
+	return &supervisedGame{Game: g, s: s, stopped: make(chan struct{})}
+}
+
+// run starts the game's loop on its own goroutine
+func (g *supervisedGame) run() {
+	go func() {
+		defer close(g.stopped)
+		defer func() {
+			if r := recover(); r != nil {
+				g.crash(r)
+			}
+		}()
+		g.Game.Run()
+	}()
+}
+
+// crash logs what went wrong under a fresh error id, stops the game and tells everyone in it.
+func (g *supervisedGame) crash(r interface{}) {
+	errorID := uuid.Must(uuid.NewV4()).String()
+	log.Errorf("game '%s' - '%s' crashed, error id %s: %v\n%s", g.ID(), g.Name(), errorID, r, debug.Stack())
+	g.mtx.Lock()
+	g.errorID = errorID
+	g.mtx.Unlock()
+
+	g.Game.Shutdown()
+	msg := event.WrapValues("GAME_CRASHED", map[string]interface{}{
+		"id":       g.ID(),
+		"error_id": errorID,
+	})
+	for _, id := range append(g.Players(), g.Spectators()...) {
+		g.s.GetUser(id, "").SendData(msg)
+	}
+	g.s.publishLobbyUpdate(g.ID())
+}
+
+func (g *supervisedGame) crashID() string {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	return g.errorID
+}
+
+func (g *supervisedGame) Status() string {
+	if g.crashID() != "" {
+		return gsinterfaces.GameCrashed
+	}
+	return g.Game.Status()
+}
+
+func (g *supervisedGame) Submit(in gsinterfaces.Input) error {
+	err := g.Game.Submit(in)
+	if id := g.crashID(); id != "" {
+		return fmt.Errorf("game '%s' has crashed, error id %s", g.ID(), id)
+	}
+	return err
+}
+
+// Run is taken care of by run
+func (g *supervisedGame) Run() {}
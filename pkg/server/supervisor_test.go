@@ -0,0 +1,73 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+func init() {
+	event.Register("TEST_PANIC", struct{}{})
+}
+
+func TestCrashedGame(t *testing.T) {
+	s := newTestServer(t)
+	us := addUsers(s, "a", "b", "bystander")
+	g := newStubGame("g", "a", "b")
+	g.onInput = func(gsinterfaces.Input) error { panic("boom") }
+	s.DebugAddGame(g)
+	other := newStubGame("other", "bystander")
+	s.DebugAddGame(other)
+
+	send(s, us[0], `{"event":"GAME","id":"g","type":"MOVE","request_id":"r1"}`)
+	nack := us[0].last("NACK")
+	if nack == nil || !strings.Contains(nack["error"].(string), "has crashed") {
+		t.Fatalf("got NACK %v", nack)
+	}
+	for _, u := range us[:2] {
+		eventually(t, u.ID()+" hears about the crash", func() bool { return u.last("GAME_CRASHED") != nil })
+		m := u.last("GAME_CRASHED")
+		if m == nil || m["id"] != "g" || m["error_id"] == "" || !strings.Contains(nack["error"].(string), m["error_id"].(string)) {
+			t.Fatalf("%s got GAME_CRASHED %v", u.ID(), m)
+		}
+	}
+	if len(us[2].received("GAME_CRASHED")) != 0 {
+		t.Fatal("told someone outside the game about the crash")
+	}
+
+	sg, err := s.getGame("g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sg.Status() != gsinterfaces.GameCrashed {
+		t.Fatalf("status %s", sg.Status())
+	}
+	select {
+	case <-g.done:
+	default:
+		t.Fatal("crashed game wasn't shut down")
+	}
+
+	// The rest of the server carries on
+	send(s, us[2], `{"event":"GAME","id":"other","type":"MOVE","request_id":"r2"}`)
+	if m := us[2].last("ACK"); m == nil || m["request_id"] != "r2" {
+		t.Fatalf("got ACK %v", m)
+	}
+}
+
+func TestPanickingHandler(t *testing.T) {
+	s := newTestServer(t)
+	u := addUsers(s, "a")[0]
+	s.Handle("TEST_PANIC", func(gsinterfaces.User, *event.General) error { panic("boom") })
+
+	send(s, u, `{"event":"TEST_PANIC","request_id":"r1"}`)
+	if m := u.last("NACK"); m == nil || m["error"] != "internal error handling 'TEST_PANIC'" {
+		t.Fatalf("got NACK %v", m)
+	}
+	send(s, u, `{"event":"LIST_GAME_TYPES","request_id":"r2"}`)
+	if m := u.last("ACK"); m == nil || m["request_id"] != "r2" {
+		t.Fatalf("server stopped handling events after a panic: %v", m)
+	}
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// file keeps one JSON document per record under a directory:
+//
+//	users/<id>.json
+//	accounts/<username>.json
+//	games/<id>.json
+//	results/<game id>.json
+//	snapshots/<game id>.json
+//	revoked/<token id>.json
+//
+// Every write goes to a temporary file that's renamed into place, so a crash never leaves a record
+// half written.
+type file struct {
+	mtx sync.RWMutex
+	dir string
+	// Every result by game id & the games each user played in, read from disk the first time results
+	// are asked for and kept up to date by SaveResult from then on
+	rmtx     sync.Mutex
+	results  map[string]GameResult
+	byPlayer map[string][]string
+	// Held while checking a username is free & taking it
+	amtx sync.Mutex
+	// Held while a profile is updated
+	umtx sync.Mutex
+}
+
+// NewFile opens, or sets up, a store in dir
+func NewFile(dir string) (Store, error) {
+	for _, sub := range []string{"users", "accounts", "games", "results", "snapshots", "revoked"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &file{dir: dir}, nil
+}
+
+func (f *file) LoadUser(id string) (*UserProfile, error) {
+	u := &UserProfile{}
+	if err := f.read("users", id, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (f *file) SaveUser(u *UserProfile) error {
+	return f.write("users", u.ID, u)
+}
+
+func (f *file) UpdateUser(id string, fn func(p *UserProfile) error) error {
+	f.umtx.Lock()
+	defer f.umtx.Unlock()
+	return updateUser(f, id, fn)
+}
+
+func (f *file) LoadAccount(username string) (*Account, error) {
+	a := &Account{}
+	if err := f.read("accounts", username, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (f *file) CreateAccount(a *Account) error {
+	f.amtx.Lock()
+	defer f.amtx.Unlock()
+	switch _, err := f.LoadAccount(a.Username); err {
+	case nil:
+		return ErrExists
+	case ErrNotFound:
+		return f.write("accounts", a.Username, a)
+	default:
+		return err
+	}
+}
+
+func (f *file) LoadGame(id string) (*gsinterfaces.GameMetadata, error) {
+	md := &gsinterfaces.GameMetadata{}
+	if err := f.read("games", id, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+func (f *file) SaveGame(md gsinterfaces.GameMetadata) error {
+	return f.write("games", md.ID, md)
+}
+
+func (f *file) SaveResult(r *GameResult) error {
+	f.rmtx.Lock()
+	defer f.rmtx.Unlock()
+	if err := f.write("results", r.GameID, r); err != nil {
+		return err
+	}
+	if f.results != nil {
+		f.index(*r)
+	}
+	return nil
+}
+
+func (f *file) Results(userID string) ([]GameResult, error) {
+	f.rmtx.Lock()
+	defer f.rmtx.Unlock()
+	if err := f.loadResults(); err != nil {
+		return nil, err
+	}
+	rs := []GameResult{}
+	for _, id := range f.byPlayer[userID] {
+		rs = append(rs, f.results[id])
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Finished.Before(rs[j].Finished) })
+	return rs, nil
+}
+
+// loadResults reads every result into the index unless that's been done already. It's called with rmtx
+// held.
+func (f *file) loadResults() error {
+	if f.results != nil {
+		return nil
+	}
+	f.results = map[string]GameResult{}
+	f.byPlayer = map[string][]string{}
+	err := f.each("results", func(id string) error {
+		r := GameResult{}
+		if err := f.read("results", id, &r); err != nil {
+			return err
+		}
+		f.index(r)
+		return nil
+	})
+	if err != nil {
+		f.results, f.byPlayer = nil, nil
+	}
+	return err
+}
+
+func (f *file) index(r GameResult) {
+	if _, ok := f.results[r.GameID]; !ok {
+		for _, p := range r.Players {
+			f.byPlayer[p] = append(f.byPlayer[p], r.GameID)
+		}
+	}
+	f.results[r.GameID] = r
+}
+
+type revokedToken struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// RevokeToken also forgets the revoked tokens that have expired since
+func (f *file) RevokeToken(id string, expires time.Time) error {
+	if err := f.write("revoked", id, &revokedToken{ID: id, Expires: expires}); err != nil {
+		return err
+	}
+	now := time.Now()
+	return f.each("revoked", func(id string) error {
+		rt := revokedToken{}
+		if err := f.read("revoked", id, &rt); err != nil || !rt.Expires.Before(now) {
+			return err
+		}
+		return f.remove("revoked", id)
+	})
+}
+
+func (f *file) TokenRevoked(id string) (bool, error) {
+	switch err := f.read("revoked", id, &revokedToken{}); err {
+	case nil:
+		return true, nil
+	case ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (f *file) SaveSnapshot(sn *Snapshot) error {
+	return f.write("snapshots", sn.GameID, sn)
+}
+
+func (f *file) DeleteSnapshot(gameID string) error {
+	return f.remove("snapshots", gameID)
+}
+
+func (f *file) Snapshots() ([]Snapshot, error) {
+	sns := []Snapshot{}
+	err := f.each("snapshots", func(id string) error {
+		sn := Snapshot{}
+		if err := f.read("snapshots", id, &sn); err != nil {
+			return err
+		}
+		sns = append(sns, sn)
+		return nil
+	})
+	return sns, err
+}
+
+// each calls f with the id of every record of a kind
+func (f *file) each(kind string, fn func(id string) error) error {
+	f.mtx.RLock()
+	names, err := filepath.Glob(filepath.Join(f.dir, kind, "*.json"))
+	f.mtx.RUnlock()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := fn(strings.TrimSuffix(filepath.Base(n), ".json")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+func (f *file) path(kind, id string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid id '%s'", id)
+	}
+	return filepath.Join(f.dir, kind, id+".json"), nil
+}
+
+func (f *file) read(kind, id string, v interface{}) error {
+	p, err := f.path(kind, id)
+	if err != nil {
+		return err
+	}
+	f.mtx.RLock()
+	b, err := ioutil.ReadFile(p)
+	f.mtx.RUnlock()
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (f *file) remove(kind, id string) error {
+	p, err := f.path(kind, id)
+	if err != nil {
+		return err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *file) write(kind, id string, v interface{}) error {
+	p, err := f.path(kind, id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(p), "."+id)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// memory keeps everything in maps, for tests & servers that don't need to remember anything
+type memory struct {
+	mtx sync.RWMutex
+	// Held while a profile is updated
+	umtx      sync.Mutex
+	users     map[string]UserProfile
+	accounts  map[string]Account
+	games     map[string]gsinterfaces.GameMetadata
+	results   []GameResult
+	snapshots map[string]Snapshot
+	revoked   map[string]time.Time
+}
+
+func NewMemory() Store {
+	return &memory{
+		users:     make(map[string]UserProfile),
+		accounts:  make(map[string]Account),
+		games:     make(map[string]gsinterfaces.GameMetadata),
+		snapshots: make(map[string]Snapshot),
+		revoked:   make(map[string]time.Time),
+	}
+}
+
+func (m *memory) LoadUser(id string) (*UserProfile, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (m *memory) SaveUser(u *UserProfile) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.users[u.ID] = *u
+	return nil
+}
+
+func (m *memory) UpdateUser(id string, f func(p *UserProfile) error) error {
+	m.umtx.Lock()
+	defer m.umtx.Unlock()
+	return updateUser(m, id, f)
+}
+
+func (m *memory) LoadAccount(username string) (*Account, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	a, ok := m.accounts[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &a, nil
+}
+
+func (m *memory) CreateAccount(a *Account) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.accounts[a.Username]; ok {
+		return ErrExists
+	}
+	m.accounts[a.Username] = *a
+	return nil
+}
+
+func (m *memory) LoadGame(id string) (*gsinterfaces.GameMetadata, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	md, ok := m.games[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &md, nil
+}
+
+func (m *memory) SaveGame(md gsinterfaces.GameMetadata) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.games[md.ID] = md
+	return nil
+}
+
+func (m *memory) SaveResult(r *GameResult) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i := range m.results {
+		if m.results[i].GameID == r.GameID {
+			m.results[i] = *r
+			return nil
+		}
+	}
+	m.results = append(m.results, *r)
+	return nil
+}
+
+func (m *memory) Results(userID string) ([]GameResult, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	rs := []GameResult{}
+	for i := range m.results {
+		if playedIn(userID, &m.results[i]) {
+			rs = append(rs, m.results[i])
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Finished.Before(rs[j].Finished) })
+	return rs, nil
+}
+
+func (m *memory) RevokeToken(id string, expires time.Time) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	now := time.Now()
+	for r, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, r)
+		}
+	}
+	m.revoked[id] = expires
+	return nil
+}
+
+func (m *memory) TokenRevoked(id string) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+func (m *memory) SaveSnapshot(sn *Snapshot) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.snapshots[sn.GameID] = *sn
+	return nil
+}
+
+func (m *memory) DeleteSnapshot(gameID string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.snapshots, gameID)
+	return nil
+}
+
+func (m *memory) Snapshots() ([]Snapshot, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	sns := make([]Snapshot, 0, len(m.snapshots))
+	for _, sn := range m.snapshots {
+		sns = append(sns, sn)
+	}
+	return sns, nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
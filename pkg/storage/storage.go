@@ -0,0 +1,132 @@
+// Package storage keeps users, games & their results around between restarts of the server.
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// ErrNotFound is returned when nothing has been stored under an id
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is returned when creating something that's already been stored under the same id
+var ErrExists = errors.New("already exists")
+
+// UserProfile is what's remembered about a user between connections
+type UserProfile struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// Account is the username the user registered, empty for guests
+	Account string `json:"account,omitempty"`
+	// Role is what the user may do on the server, empty for regular players
+	Role   string `json:"role,omitempty"`
+	Banned bool   `json:"banned,omitempty"`
+}
+
+// Account is a registered username & the password that logs in as its user
+type Account struct {
+	Username     string    `json:"username"`
+	UserID       string    `json:"user_id"`
+	PasswordHash []byte    `json:"password_hash"`
+	Created      time.Time `json:"created"`
+}
+
+// GameResult is how a game ended and who took part
+type GameResult struct {
+	GameID   string    `json:"game_id"`
+	Type     string    `json:"type"`
+	Players  []string  `json:"players"`
+	Winners  []string  `json:"winners"`
+	Outcome  string    `json:"outcome"`
+	Finished time.Time `json:"finished"`
+}
+
+// Snapshot is a running game saved so it can be picked up again after a restart
+type Snapshot struct {
+	GameID string    `json:"game_id"`
+	Type   string    `json:"type"`
+	Data   []byte    `json:"data"`
+	Taken  time.Time `json:"taken"`
+}
+
+// Store persists the server's long lived state. Implementations are safe for concurrent use.
+type Store interface {
+	LoadUser(id string) (*UserProfile, error)
+	SaveUser(u *UserProfile) error
+	// UpdateUser loads a user's profile, blank if nothing is stored yet, lets f change it & saves it
+	// unless f fails. Updates run one at a time so they can't undo each other.
+	UpdateUser(id string, f func(p *UserProfile) error) error
+	LoadAccount(username string) (*Account, error)
+	// CreateAccount stores a new account, failing with ErrExists if the username is taken
+	CreateAccount(a *Account) error
+	LoadGame(id string) (*gsinterfaces.GameMetadata, error)
+	SaveGame(md gsinterfaces.GameMetadata) error
+	SaveResult(r *GameResult) error
+	// Results lists every result a user played in, oldest first
+	Results(userID string) ([]GameResult, error)
+	// RevokeToken stops the token with id from being accepted, it only has to be remembered until it
+	// would have expired anyway
+	RevokeToken(id string, expires time.Time) error
+	TokenRevoked(id string) (bool, error)
+	SaveSnapshot(sn *Snapshot) error
+	DeleteSnapshot(gameID string) error
+	Snapshots() ([]Snapshot, error)
+	Close() error
+}
+
+// Stats sums up results for one user per game type, with "" holding the totals
+type Stats map[string]*TypeStats
+
+type TypeStats struct {
+	Played int `json:"played"`
+	Won    int `json:"won"`
+}
+
+// StatsFor tallies a user's results
+func StatsFor(userID string, results []GameResult) Stats {
+	s := Stats{"": &TypeStats{}}
+	for _, r := range results {
+		if _, ok := s[r.Type]; !ok {
+			s[r.Type] = &TypeStats{}
+		}
+		won := 0
+		for _, w := range r.Winners {
+			if w == userID {
+				won = 1
+			}
+		}
+		for _, t := range []string{"", r.Type} {
+			s[t].Played++
+			s[t].Won += won
+		}
+	}
+	return s
+}
+
+// updateUser is UpdateUser for stores that hold their own lock around it
+func updateUser(s Store, id string, f func(p *UserProfile) error) error {
+	p, err := s.LoadUser(id)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		p = &UserProfile{ID: id}
+	default:
+		return err
+	}
+	if err := f(p); err != nil {
+		return err
+	}
+	return s.SaveUser(p)
+}
+
+func playedIn(userID string, r *GameResult) bool {
+	for _, p := range r.Players {
+		if p == userID {
+			return true
+		}
+	}
+	return false
+}
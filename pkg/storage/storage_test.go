@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stores opens one of every kind of store, the file store in a fresh directory
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	f, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemory(), "file": f}
+}
+
+var testFinished = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func result(gameID string, finished time.Duration, winners []string, players ...string) *GameResult {
+	return &GameResult{
+		GameID:   gameID,
+		Type:     "MOOSE",
+		Players:  players,
+		Winners:  winners,
+		Outcome:  "test",
+		Finished: testFinished.Add(finished),
+	}
+}
+
+func gameIDs(rs []GameResult) []string {
+	ids := []string{}
+	for _, r := range rs {
+		ids = append(ids, r.GameID)
+	}
+	return ids
+}
+
+func TestUsers(t *testing.T) {
+	for name, s := range stores(t) {
+		if _, err := s.LoadUser("u"); err != ErrNotFound {
+			t.Fatalf("%s: got %v", name, err)
+		}
+		if err := s.SaveUser(&UserProfile{ID: "u", Name: "Bob", Role: "admin"}); err != nil {
+			t.Fatal(err)
+		}
+		p, err := s.LoadUser("u")
+		if err != nil || p.Name != "Bob" || p.Role != "admin" {
+			t.Fatalf("%s: got %+v, %v", name, p, err)
+		}
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	for name, s := range stores(t) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				s.UpdateUser("u", func(p *UserProfile) error {
+					p.Name += fmt.Sprint(i)
+					return nil
+				})
+			}(i)
+		}
+		wg.Wait()
+		p, err := s.LoadUser("u")
+		if err != nil || p.ID != "u" || len(p.Name) != 10 {
+			t.Fatalf("%s: updates were lost, got %+v, %v", name, p, err)
+		}
+
+		failed := errors.New("failed")
+		if err := s.UpdateUser("u", func(p *UserProfile) error {
+			p.Name = "changed"
+			return failed
+		}); err != failed {
+			t.Fatalf("%s: got %v", name, err)
+		}
+		if p, _ := s.LoadUser("u"); p.Name == "changed" {
+			t.Fatalf("%s: saved a failed update", name)
+		}
+	}
+}
+
+func TestResults(t *testing.T) {
+	for name, s := range stores(t) {
+		if err := s.SaveResult(result("g1", time.Hour, []string{"a"}, "a", "b")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveResult(result("g2", time.Minute, []string{"b"}, "b", "c")); err != nil {
+			t.Fatal(err)
+		}
+		rs, err := s.Results("b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Oldest first
+		if ids := gameIDs(rs); len(ids) != 2 || ids[0] != "g2" || ids[1] != "g1" {
+			t.Fatalf("%s: got %v", name, ids)
+		}
+
+		// Saved after the results have been read once
+		if err := s.SaveResult(result("g3", 2*time.Hour, nil, "a")); err != nil {
+			t.Fatal(err)
+		}
+		rs, err = s.Results("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := gameIDs(rs); len(ids) != 2 || ids[0] != "g1" || ids[1] != "g3" {
+			t.Fatalf("%s: got %v", name, ids)
+		}
+		if rs, err := s.Results("nobody"); err != nil || len(rs) != 0 {
+			t.Fatalf("%s: got %v, %v", name, rs, err)
+		}
+
+		stats := StatsFor("a", rs)
+		if stats[""].Played != 2 || stats[""].Won != 1 || stats["MOOSE"].Won != 1 {
+			t.Fatalf("%s: got %+v", name, stats[""])
+		}
+	}
+}
+
+func TestFileResultsSurviveReopening(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SaveResult(result("g1", 0, nil, "a"))
+	s.SaveResult(result("g2", time.Second, nil, "a"))
+	reopened, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := reopened.Results("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := gameIDs(rs); len(ids) != 2 || ids[0] != "g1" || ids[1] != "g2" {
+		t.Fatalf("got %v", ids)
+	}
+	// Saving a result again replaces it instead of counting the game twice
+	reopened.SaveResult(result("g2", time.Second, []string{"a"}, "a"))
+	rs, _ = reopened.Results("a")
+	if len(rs) != 2 || len(rs[1].Winners) != 1 {
+		t.Fatalf("got %+v", rs)
+	}
+}
@@ -0,0 +1,11 @@
+package websocket
+
+import "github.com/GregoryDosh/game-server/pkg/metrics"
+
+var (
+	messagesSent      = metrics.NewCounter("gameserver_websocket_messages_sent_total", "Messages written to websockets.")
+	messagesDropped   = metrics.NewCounter("gameserver_websocket_messages_dropped_total", "Messages dropped because a connection's outbound queue was full.")
+	messagesCoalesced = metrics.NewCounter("gameserver_websocket_messages_coalesced_total", "Queued messages replaced by a newer state for the same key.")
+	slowDisconnects   = metrics.NewCounter("gameserver_websocket_slow_disconnects_total", "Connections dropped for not keeping up with their outbound queue.")
+	writeSeconds      = metrics.NewHistogram("gameserver_websocket_write_seconds", "How long writing a message to a websocket took.", metrics.DefBuckets)
+)
@@ -0,0 +1,181 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
+)
+
+// What a connection's outbound queue does once it's full
+const (
+	// PolicyExpire lets up to Size more messages wait for room, dropping any that wait longer than
+	// ExpireAfter. The sender never waits.
+	PolicyExpire = "expire"
+	// PolicyDropOldest makes room by dropping the oldest queued message
+	PolicyDropOldest = "drop-oldest"
+	// PolicyCoalesce replaces any queued state snapshot with a newer one for the same key, otherwise drops the oldest message
+	PolicyCoalesce = "coalesce"
+	// PolicyDisconnect closes the connection of a client that can't keep up
+	PolicyDisconnect = "disconnect"
+)
+
+// QueueConfig sizes the outbound queue every connection of a user gets & picks what happens when it fills up
+type QueueConfig struct {
+	Size        int
+	Policy      string
+	ExpireAfter time.Duration
+}
+
+// DefaultQueueConfig returns the queue settings used when nothing else is configured
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Size:        64,
+		Policy:      PolicyCoalesce,
+		ExpireAfter: time.Second,
+	}
+}
+
+// Validate checks the queue settings make sense
+func (c QueueConfig) Validate() error {
+	if c.Size < 1 {
+		return fmt.Errorf("queue size must be at least 1, got %d", c.Size)
+	}
+	switch c.Policy {
+	case PolicyExpire, PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+		return nil
+	}
+	return fmt.Errorf("unknown queue policy '%s'", c.Policy)
+}
+
+// queueCounters are shared between all connections of a user
+type queueCounters struct {
+	sent            uint64
+	dropped         uint64
+	coalesced       uint64
+	slowDisconnects uint64
+}
+
+type outboundMessage struct {
+	// Messages sharing a non-empty key are snapshots of the same state, only the newest one matters
+	key string
+	msg []byte
+	// When the message was queued, for the expire policy to drop messages that wait too long for room
+	queued time.Time
+}
+
+type outboundQueue struct {
+	mtx      sync.Mutex
+	config   QueueConfig
+	items    []outboundMessage
+	counters *queueCounters
+	ready    chan struct{}
+}
+
+func newOutboundQueue(c QueueConfig, counters *queueCounters) *outboundQueue {
+	return &outboundQueue{
+		config:   c,
+		counters: counters,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// push queues a message according to the queue's policy and returns false if the connection should
+// be dropped for not keeping up.
+func (q *outboundQueue) push(m outboundMessage) bool {
+	q.mtx.Lock()
+	if m.key != "" && q.config.Policy == PolicyCoalesce {
+		for i, o := range q.items {
+			if o.key == m.key {
+				q.items = append(q.items[:i], q.items[i+1:]...)
+				atomic.AddUint64(&q.counters.coalesced, 1)
+				messagesCoalesced.Inc()
+				break
+			}
+		}
+	}
+	if len(q.items) >= q.config.Size {
+		switch q.config.Policy {
+		case PolicyDisconnect:
+			q.mtx.Unlock()
+			atomic.AddUint64(&q.counters.slowDisconnects, 1)
+			slowDisconnects.Inc()
+			return false
+		case PolicyExpire:
+			m.queued = time.Now()
+			q.expireWaiting(m.queued)
+			if len(q.items) >= 2*q.config.Size {
+				q.mtx.Unlock()
+				q.drop(1)
+				return true
+			}
+		default:
+			q.items = q.items[1:]
+			q.drop(1)
+		}
+	}
+	q.items = append(q.items, m)
+	q.mtx.Unlock()
+	signal(q.ready)
+	return true
+}
+
+// expireWaiting drops the messages waiting for room that have waited longer than ExpireAfter. It's
+// called with the lock held.
+func (q *outboundQueue) expireWaiting(now time.Time) {
+	if len(q.items) <= q.config.Size {
+		return
+	}
+	kept := q.items[:q.config.Size]
+	for _, m := range q.items[q.config.Size:] {
+		if now.Sub(m.queued) <= q.config.ExpireAfter {
+			kept = append(kept, m)
+		}
+	}
+	q.drop(len(q.items) - len(kept))
+	q.items = kept
+}
+
+func (q *outboundQueue) drop(n int) {
+	atomic.AddUint64(&q.counters.dropped, uint64(n))
+	messagesDropped.Add(uint64(n))
+}
+
+func (q *outboundQueue) pop() ([]byte, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.config.Policy == PolicyExpire {
+		q.expireWaiting(time.Now())
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	m := q.items[0]
+	q.items = q.items[1:]
+	return m.msg, true
+}
+
+func (q *outboundQueue) depth() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.items)
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (c *queueCounters) stats(depth int) gsinterfaces.QueueStats {
+	return gsinterfaces.QueueStats{
+		Depth:           depth,
+		Sent:            atomic.LoadUint64(&c.sent),
+		Dropped:         atomic.LoadUint64(&c.dropped),
+		Coalesced:       atomic.LoadUint64(&c.coalesced),
+		SlowDisconnects: atomic.LoadUint64(&c.slowDisconnects),
+	}
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestQueue(policy string, size int) (*outboundQueue, *queueCounters) {
+	counters := &queueCounters{}
+	return newOutboundQueue(QueueConfig{Size: size, Policy: policy, ExpireAfter: 50 * time.Millisecond}, counters), counters
+}
+
+func message(key, msg string) outboundMessage {
+	return outboundMessage{key: key, msg: []byte(msg)}
+}
+
+// drain pops everything left in q
+func drain(q *outboundQueue) []string {
+	var msgs []string
+	for {
+		m, ok := q.pop()
+		if !ok {
+			return msgs
+		}
+		msgs = append(msgs, string(m))
+	}
+}
+
+func TestQueueConfigValidate(t *testing.T) {
+	if err := DefaultQueueConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []QueueConfig{{Size: 0, Policy: PolicyExpire}, {Size: 1, Policy: "wait"}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v validated", c)
+		}
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	q, counters := newTestQueue(PolicyDropOldest, 2)
+	for _, m := range []string{"a", "b", "c"} {
+		if !q.push(message("", m)) {
+			t.Fatal("dropped the connection")
+		}
+	}
+	if got := fmt.Sprint(drain(q)); got != "[b c]" {
+		t.Fatalf("got %s", got)
+	}
+	if s := counters.stats(0); s.Dropped != 1 {
+		t.Fatalf("got %+v", s)
+	}
+}
+
+func TestQueueCoalesce(t *testing.T) {
+	q, counters := newTestQueue(PolicyCoalesce, 2)
+	q.push(message("state", "old"))
+	q.push(message("", "a"))
+	q.push(message("state", "new"))
+	if got := fmt.Sprint(drain(q)); got != "[a new]" {
+		t.Fatalf("got %s", got)
+	}
+	if s := counters.stats(0); s.Coalesced != 1 || s.Dropped != 0 {
+		t.Fatalf("got %+v", s)
+	}
+}
+
+func TestQueueDisconnect(t *testing.T) {
+	q, counters := newTestQueue(PolicyDisconnect, 1)
+	if !q.push(message("", "a")) {
+		t.Fatal("dropped the connection before the queue was full")
+	}
+	if q.push(message("", "b")) {
+		t.Fatal("kept a connection that can't keep up")
+	}
+	if s := counters.stats(0); s.SlowDisconnects != 1 {
+		t.Fatalf("got %+v", s)
+	}
+}
+
+func TestQueueExpireNeverWaits(t *testing.T) {
+	q, counters := newTestQueue(PolicyExpire, 2)
+	start := time.Now()
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		if !q.push(message("", m)) {
+			t.Fatal("dropped the connection")
+		}
+	}
+	if time.Since(start) >= q.config.ExpireAfter {
+		t.Fatal("push waited for room")
+	}
+	// Up to Size messages wait for room past a full queue, anything more is dropped
+	if s := counters.stats(q.depth()); s.Depth != 4 || s.Dropped != 1 {
+		t.Fatalf("got %+v", s)
+	}
+	if got := fmt.Sprint(drain(q)); got != "[a b c d]" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestQueueExpireDropsWaiting(t *testing.T) {
+	q, counters := newTestQueue(PolicyExpire, 1)
+	q.push(message("", "a"))
+	q.push(message("", "late"))
+	time.Sleep(2 * q.config.ExpireAfter)
+	if got := fmt.Sprint(drain(q)); got != "[a]" {
+		t.Fatalf("got %s", got)
+	}
+	if s := counters.stats(0); s.Dropped != 1 {
+		t.Fatalf("got %+v", s)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/GregoryDosh/game-server/pkg/gsinterfaces"
 	namesgenerator "github.com/moby/moby/pkg/namesgenerator"
 
 	log "github.com/Sirupsen/logrus"
@@ -15,15 +18,43 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+// How many already sent messages are kept around per user for RESUME
+const replayBufferSize = 128
+
+type sequencedMessage struct {
+	seq uint64
+	key string
+	msg []byte
+}
+
+// connection is a single websocket of a user with its own outbound queue & writer
+type connection struct {
+	ws    *websocket.Conn
+	queue *outboundQueue
+	done  chan struct{}
+	// closing asks the writer to flush the queue & close the socket with closeMsg, it closes stopped
+	// once it has
+	closing  chan struct{}
+	closeMsg []byte
+	stopped  chan struct{}
+}
+
 type User struct {
-	id             string
-	eventHandler   func(userUUID string, b []byte)
-	messagesToUser chan []byte
-	badConnections chan *websocket.Conn
-	connmtx        sync.RWMutex
-	connections    map[*websocket.Conn]bool
-	profilemtx     sync.RWMutex
-	name           string
+	id                string
+	eventHandler      func(userUUID string, b []byte)
+	disconnectHandler func(userUUID string)
+	queueConfig       QueueConfig
+	counters          queueCounters
+	connmtx           sync.RWMutex
+	connections       map[*websocket.Conn]*connection
+	profilemtx        sync.RWMutex
+	name              string
+	seqmtx            sync.Mutex
+	seq               uint64
+	replay            []sequencedMessage
+	// The last seq sent before the newest connection was added, everything after it was queued on that
+	// connection
+	connectSeq uint64
 }
 
 func (u *User) ID() string {
@@ -49,14 +80,105 @@ func (u *User) SetName(n string) error {
 	return nil
 }
 
+// SendData stamps the message with the user's next sequence number, remembers it for replay and queues
+// it up on every connection.
 func (u *User) SendData(b []byte) {
-	if u.messagesToUser != nil {
-		select {
-		case u.messagesToUser <- b:
-		default:
-			log.Warnf("lost message %s", b)
+	u.send("", b)
+}
+
+// SendState is SendData for full state snapshots. A newer snapshot under the same key may replace one
+// still waiting to go out, in which case the client sees a gap in the sequence numbers.
+func (u *User) SendState(key string, b []byte) {
+	u.send(key, b)
+}
+
+func (u *User) send(key string, b []byte) {
+	u.seqmtx.Lock()
+	u.seq++
+	b = event.WithSequence(b, u.seq)
+	u.replay = append(u.replay, sequencedMessage{seq: u.seq, key: key, msg: b})
+	if len(u.replay) > replayBufferSize {
+		u.replay = u.replay[len(u.replay)-replayBufferSize:]
+	}
+	// Queued before letting go of the lock so every connection gets the messages in seq order
+	slow := u.enqueue(outboundMessage{key: key, msg: b})
+	u.seqmtx.Unlock()
+	u.dropConnections(slow)
+}
+
+// enqueue hands a message to each connection's queue without waiting on any of them, returning the
+// connections that can't keep up. It's called with seqmtx held.
+func (u *User) enqueue(m outboundMessage) []*websocket.Conn {
+	var slow []*websocket.Conn
+	u.connmtx.RLock()
+	defer u.connmtx.RUnlock()
+	for _, c := range u.connections {
+		if !c.queue.push(m) {
+			slow = append(slow, c.ws)
 		}
 	}
+	return slow
+}
+
+func (u *User) dropConnections(cs []*websocket.Conn) {
+	for _, c := range cs {
+		log.Warnf("disconnecting slow connection for %s", u.Name())
+		u.dropConnection(c)
+	}
+}
+
+// Resume re-queues what was sent after lastSeq up until the newest connection was added. Whatever came
+// after was already queued on that connection, like its GREETING. It returns false when those messages
+// have already fallen out of the replay buffer, or were never sent by this server, and the client needs a
+// full resync. A state snapshot is left out when a newer one under the same key has been sent since, so
+// a resume never leaves the client on stale state. Messages may be delivered twice around a resume so
+// clients should skip any seq they've already seen.
+func (u *User) Resume(lastSeq uint64) bool {
+	u.seqmtx.Lock()
+	if lastSeq > u.seq {
+		u.seqmtx.Unlock()
+		return false
+	}
+	latest := map[string]uint64{}
+	for _, m := range u.replay {
+		if m.key != "" {
+			latest[m.key] = m.seq
+		}
+	}
+	var missed [][]byte
+	for i, m := range u.replay {
+		if i == 0 && m.seq > lastSeq+1 {
+			u.seqmtx.Unlock()
+			return false
+		}
+		if m.seq > lastSeq && m.seq <= u.connectSeq && (m.key == "" || latest[m.key] == m.seq) {
+			missed = append(missed, m.msg)
+		}
+	}
+	var slow []*websocket.Conn
+	for _, m := range missed {
+		slow = append(slow, u.enqueue(outboundMessage{msg: m})...)
+	}
+	u.seqmtx.Unlock()
+	u.dropConnections(slow)
+	return true
+}
+
+// QueueStats sums up the outbound queues of all the user's connections
+func (u *User) QueueStats() gsinterfaces.QueueStats {
+	depth := 0
+	u.connmtx.RLock()
+	for _, c := range u.connections {
+		depth += c.queue.depth()
+	}
+	u.connmtx.RUnlock()
+	return u.counters.stats(depth)
+}
+
+func (u *User) Connections() int {
+	u.connmtx.RLock()
+	defer u.connmtx.RUnlock()
+	return len(u.connections)
 }
 
 func (u *User) SetFromHandler(h func(userUUID string, b []byte)) {
@@ -65,6 +187,13 @@ func (u *User) SetFromHandler(h func(userUUID string, b []byte)) {
 	}
 }
 
+// SetDisconnectHandler sets what's called whenever the user is left without any connections
+func (u *User) SetDisconnectHandler(h func(userUUID string)) {
+	if h != nil {
+		u.disconnectHandler = h
+	}
+}
+
 func (u *User) AddConnection(ps ...interface{}) error {
 	if len(ps) != 1 {
 		return errors.New("invalid number parameters for this type of user")
@@ -80,12 +209,22 @@ func (u *User) AddConnection(ps ...interface{}) error {
 	}
 	u.connmtx.RUnlock()
 
+	conn := &connection{
+		ws:      c,
+		queue:   newOutboundQueue(u.queueConfig, &u.counters),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	u.seqmtx.Lock()
+	u.connectSeq = u.seq
 	u.connmtx.Lock()
-	u.connections[c] = true
+	u.connections[c] = conn
 	u.connmtx.Unlock()
+	u.seqmtx.Unlock()
+	go u.messageToConnectionHandler(conn)
 	go u.messageFromUserHandler(c)
-	u.messagesToUser <- event.WrapValue("GREETING", "message", fmt.Sprintf("Hello %s", u.Name()))
-	u.messagesToUser <- event.WrapValue("ANNOUNCEMENTS", "message", "Nothing new to report here.")
+	u.SendData(event.WrapValue("GREETING", "message", fmt.Sprintf("Hello %s", u.Name())))
 	return nil
 }
 
@@ -98,66 +237,138 @@ func (u *User) RemoveConnection(ps ...interface{}) error {
 		return errors.New("wrong parameter for this type of user")
 	}
 	u.connmtx.RLock()
-	if _, ok := u.connections[c]; ok {
-		u.connmtx.RUnlock()
-		return errors.New("connection already added")
+	_, ok = u.connections[c]
+	u.connmtx.RUnlock()
+	if !ok {
+		return errors.New("unknown connection")
 	}
-	u.badConnections <- c
+	u.dropConnection(c)
 	return nil
 }
 
+// Shutdown sends every connection of the user what's still queued, tells it the server is going away &
+// closes it.
 func (u *User) Shutdown() {
-	log.Warnf("Received shutdown notification for user %s", u.Name())
+	log.Debugf("Received shutdown notification for user %s", u.Name())
+	u.closeAll(websocket.CloseGoingAway, "server shutting down")
+}
+
+// Disconnect closes every connection of the user for breaking the rules, e.g. when they're kicked
+func (u *User) Disconnect(reason string) {
+	log.Debugf("Disconnecting user %s: %s", u.Name(), reason)
+	u.closeAll(websocket.ClosePolicyViolation, reason)
+}
+
+// Control frames carry at most 125 bytes, 2 of them are the close code
+const maxCloseReason = 123
+
+// closeAll closes every connection with code & reason, cutting the reason short if it doesn't fit in a
+// close frame, which would otherwise fail to be sent at all.
+func (u *User) closeAll(code int, reason string) {
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
 	u.connmtx.Lock()
-	for c := range u.connections {
-		c.Close()
+	conns := make([]*connection, 0, len(u.connections))
+	for c, conn := range u.connections {
+		delete(u.connections, c)
+		conn.closeMsg = msg
+		close(conn.closing)
+		conns = append(conns, conn)
 	}
 	u.connmtx.Unlock()
+	for _, conn := range conns {
+		<-conn.stopped
+	}
+	if len(conns) > 0 {
+		u.disconnected()
+	}
 }
 
-func (u *User) messageToUserHandler() {
-	log.Debugf("➡️📪 started messageToUserHandler for %s", u.Name())
-	defer log.Debugf("🛑 ➡️📪 started messageToUserHandler for %s", u.Name())
+func (u *User) disconnected() {
+	if u.disconnectHandler != nil {
+		u.disconnectHandler(u.ID())
+	}
+}
+
+// messageToConnectionHandler writes a single connection's queue out, so one slow socket can't hold up
+// the user's other connections.
+func (u *User) messageToConnectionHandler(c *connection) {
+	log.Debugf("➡️📪 started messageToConnectionHandler for %s", u.Name())
+	defer log.Debugf("🛑 ➡️📪 stopped messageToConnectionHandler for %s", u.Name())
 	pingTicker := time.NewTicker(5 * time.Second)
 	defer func() {
 		pingTicker.Stop()
+		close(c.stopped)
 	}()
 	for {
 		select {
-		case msg := <-u.messagesToUser:
-			u.connmtx.RLock()
-			for c := range u.connections {
-				c.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+		case <-c.queue.ready:
+			for msg, ok := c.queue.pop(); ok; msg, ok = c.queue.pop() {
+				start := time.Now()
+				c.ws.SetWriteDeadline(start.Add(10 * time.Second))
+				if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
 					log.Error(err)
+					u.dropConnection(c.ws)
+					return
 				}
+				writeSeconds.Observe(time.Since(start).Seconds())
+				atomic.AddUint64(&u.counters.sent, 1)
+				messagesSent.Inc()
+				log.Debugf("📪➡️😀 successfully sent %s", msg)
 			}
-			log.Debugf("📪➡️😀 successfully sent %s", msg)
-			u.connmtx.RUnlock()
 		case <-pingTicker.C:
-			u.connmtx.RLock()
-			for c := range u.connections {
-				c.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
-					// Assume client disconnected and add them to the badConnections queue to be cleaned up
-					u.badConnections <- c
-				}
+			c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				// Assume client disconnected
+				u.dropConnection(c.ws)
+				return
 			}
-			u.connmtx.RUnlock()
+		case <-c.done:
+			return
+		case <-c.closing:
+			u.closeConnection(c)
+			return
 		}
 	}
 }
 
-func (u *User) badConnectionHandler() {
-	log.Debugf("📪➡️ started badConnectionHandler for %s", u.Name())
-	defer log.Debugf("🛑 📪➡️ stopped badConnectionHandler for %s", u.Name())
-	for {
-		c := <-u.badConnections
-		log.Debugf("closing connection for %s", u.Name())
-		u.connmtx.Lock()
+// closeConnection flushes a connection's queue and closes it with its close message
+func (u *User) closeConnection(c *connection) {
+	deadline := time.Now().Add(time.Second)
+	c.ws.SetWriteDeadline(deadline)
+	for msg, ok := c.queue.pop(); ok; msg, ok = c.queue.pop() {
+		if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+			break
+		}
+		atomic.AddUint64(&u.counters.sent, 1)
+		messagesSent.Inc()
+	}
+	if err := c.ws.WriteControl(websocket.CloseMessage, c.closeMsg, deadline); err != nil {
+		log.Debugf("unable to send close to %s: %s", u.Name(), err)
+	}
+	c.ws.Close()
+}
+
+// dropConnection forgets a connection that failed or can't keep up and closes it, without waiting on
+// its writer
+func (u *User) dropConnection(c *websocket.Conn) {
+	log.Debugf("closing connection for %s", u.Name())
+	u.connmtx.Lock()
+	conn, ok := u.connections[c]
+	if ok {
 		delete(u.connections, c)
-		u.connmtx.Unlock()
-		c.Close()
+		close(conn.done)
+	}
+	last := ok && len(u.connections) == 0
+	u.connmtx.Unlock()
+	c.Close()
+	if last {
+		u.disconnected()
 	}
 }
 
@@ -170,14 +381,14 @@ func (u *User) messageFromUserHandler(c *websocket.Conn) {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Error(err)
 			}
-			u.badConnections <- c
+			u.dropConnection(c)
 			return
 		}
 		u.eventHandler(u.ID(), msg)
 	}
 }
 
-func NewUser(id string, name string) *User {
+func NewUser(id string, name string, qc QueueConfig) *User {
 	if id == "" {
 		id = uuid.Must(uuid.NewV4()).String()
 	}
@@ -185,15 +396,11 @@ func NewUser(id string, name string) *User {
 		gen_name := strings.Split(namesgenerator.GetRandomName(0), "_")
 		name = fmt.Sprintf("%s %s", strings.Title(gen_name[0]), strings.Title(gen_name[1]))
 	}
-	u := &User{
-		name:           name,
-		id:             id,
-		eventHandler:   nil,
-		messagesToUser: make(chan []byte, 5),
-		connections:    make(map[*websocket.Conn]bool, 0),
-		badConnections: make(chan *websocket.Conn, 5),
-	}
-	go u.messageToUserHandler()
-	go u.badConnectionHandler()
-	return u
+	return &User{
+		name:         name,
+		id:           id,
+		eventHandler: nil,
+		queueConfig:  qc,
+		connections:  make(map[*websocket.Conn]*connection, 0),
+	}
 }
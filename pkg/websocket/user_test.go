@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GregoryDosh/game-server/pkg/event"
+	"github.com/gorilla/websocket"
+)
+
+// dial connects a client websocket to u
+func dial(t *testing.T, u *User) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := u.AddConnection(c); err != nil {
+			c.Close()
+		}
+	}))
+	t.Cleanup(hs.Close)
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+type received struct {
+	Seq     uint64 `json:"seq"`
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+func read(t *testing.T, c *websocket.Conn) received {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := received{}
+	if err := c.ReadJSON(&r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// quiet fails the test if anything more arrives on c
+func quiet(t *testing.T, c *websocket.Conn) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, b, err := c.ReadMessage()
+	if err == nil {
+		t.Fatalf("unexpected message %s", b)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal(err)
+	}
+}
+
+func newTestUser(qc QueueConfig) *User {
+	u := NewUser("u", "Test User", qc)
+	u.SetFromHandler(func(string, []byte) {})
+	return u
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	c := dial(t, u)
+	if r := read(t, c); r.Event != "GREETING" || r.Seq != 1 {
+		t.Fatalf("got %+v", r)
+	}
+	u.SendData(event.WrapValue("A", "message", "a"))
+	u.SendState("key", event.WrapValue("B", "message", "b"))
+	for i, want := range []string{"A", "B"} {
+		if r := read(t, c); r.Event != want || r.Seq != uint64(i+2) {
+			t.Fatalf("got %+v, want %s", r, want)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	old := dial(t, u)
+	read(t, old)
+	u.SendData(event.WrapValue("A", "message", "seen"))
+	if r := read(t, old); r.Seq != 2 {
+		t.Fatalf("got %+v", r)
+	}
+	old.Close()
+	waitFor(t, "the old connection is dropped", func() bool { return u.Connections() == 0 })
+	u.SendData(event.WrapValue("A", "message", "missed"))
+
+	c := dial(t, u)
+	if r := read(t, c); r.Event != "GREETING" || r.Seq != 4 {
+		t.Fatalf("got %+v", r)
+	}
+	u.SendData(event.WrapValue("A", "message", "live"))
+	if r := read(t, c); r.Message != "live" {
+		t.Fatalf("got %+v", r)
+	}
+	if !u.Resume(2) {
+		t.Fatal("unable to resume")
+	}
+	// Only what went out while the client was away is sent again, not the new connection's own greeting
+	if r := read(t, c); r.Message != "missed" || r.Seq != 3 {
+		t.Fatalf("got %+v", r)
+	}
+	quiet(t, c)
+
+	if u.Resume(10) {
+		t.Fatal("resumed from a seq that was never sent")
+	}
+}
+
+func TestResumeSkipsSupersededState(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	old := dial(t, u)
+	read(t, old)
+	old.Close()
+	waitFor(t, "the old connection is dropped", func() bool { return u.Connections() == 0 })
+	u.SendState("game:g", event.WrapValue("STATE", "message", "stale"))
+	u.SendData(event.WrapValue("A", "message", "missed"))
+
+	c := dial(t, u)
+	read(t, c)
+	u.SendState("game:g", event.WrapValue("STATE", "message", "fresh"))
+	if r := read(t, c); r.Message != "fresh" {
+		t.Fatalf("got %+v", r)
+	}
+	if !u.Resume(1) {
+		t.Fatal("unable to resume")
+	}
+	// The stale state would otherwise land after the fresh one & leave the client on it
+	if r := read(t, c); r.Message != "missed" {
+		t.Fatalf("got %+v", r)
+	}
+	quiet(t, c)
+}
+
+func TestResumeAfterBufferOverflow(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	for i := 0; i < replayBufferSize+10; i++ {
+		u.SendData(event.WrapValue("A", "message", "x"))
+	}
+	if u.Resume(1) {
+		t.Fatal("resumed from a seq that fell out of the replay buffer")
+	}
+	if !u.Resume(20) {
+		t.Fatal("unable to resume from a seq still in the replay buffer")
+	}
+}
+
+func TestWithSequenceKeepsJSON(t *testing.T) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(event.WithSequence([]byte(`{}`), 7), &m); err != nil || m["seq"] != float64(7) {
+		t.Fatalf("got %v, %v", m, err)
+	}
+}
+
+func TestConcurrentSendsArriveInOrder(t *testing.T) {
+	u := newTestUser(QueueConfig{Size: 1024, Policy: PolicyExpire, ExpireAfter: time.Second})
+	c := dial(t, u)
+	read(t, c)
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 50; j++ {
+				u.SendData(event.WrapValue("A", "message", "x"))
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	for want := uint64(2); want <= 201; want++ {
+		if r := read(t, c); r.Seq != want {
+			t.Fatalf("got seq %d, want %d", r.Seq, want)
+		}
+	}
+}
+
+// closedWith reads from c until the server closes it
+func closedWith(t *testing.T, c *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			ce, ok := err.(*websocket.CloseError)
+			if !ok {
+				t.Fatalf("closed with %v", err)
+			}
+			return ce
+		}
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	left := make(chan string, 1)
+	u.SetDisconnectHandler(func(id string) { left <- id })
+	c := dial(t, u)
+	read(t, c)
+	u.Disconnect("kicked")
+	if ce := closedWith(t, c); ce.Code != websocket.ClosePolicyViolation || ce.Text != "kicked" {
+		t.Fatalf("got %+v", ce)
+	}
+	select {
+	case id := <-left:
+		if id != "u" {
+			t.Fatalf("handler called for %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the disconnect handler wasn't called")
+	}
+}
+
+func TestDisconnectLongReason(t *testing.T) {
+	u := newTestUser(DefaultQueueConfig())
+	c := dial(t, u)
+	read(t, c)
+	u.Disconnect(strings.Repeat("é", 100))
+	ce := closedWith(t, c)
+	if ce.Code != websocket.ClosePolicyViolation || len(ce.Text) != 122 || !utf8.ValidString(ce.Text) {
+		t.Fatalf("got %d %q", ce.Code, ce.Text)
+	}
+}